@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	OutcomeGained = "gained"
+	OutcomeLost   = "lost"
+	OutcomeOwn    = "own"
+)
+
+// ip differences are stored rounded to this many item power, so fights with about the same
+// difference share a row
+const ipDifferenceBucket = 10.0
+
+// reportBuildFilter is the slots aggregated for the reports
+var reportBuildFilter = BuildFilter{
+	MainHand: true,
+	OffHand:  true,
+	Head:     true,
+	Chest:    true,
+	Foot:     true,
+	Cape:     true,
+	Potion:   false,
+	Food:     false,
+	Mount:    false,
+	Bag:      false,
+}
+
+type SlotItem struct {
+	Slot string
+	Item Item
+}
+
+type ItemAggregate struct {
+	Slot         string
+	Kills        int64
+	Deaths       int64
+	SumAverageIp float64
+	SumItemIp    float64
+	SumGearIp    float64
+	SumMastery   float64
+}
+
+type BuildAggregate struct {
+	Kills        int64
+	Deaths       int64
+	SumAverageIp float64
+}
+
+// ValueCount is how often an item was killed, lost or worn, prices are applied when a report is made
+type ValueCount struct {
+	Outcome string
+	Item    Item
+	Count   int64
+}
+
+// EventPower is the item power of an event's gear. It is worked out before the insert transaction
+// starts, since item metadata may have to be read from the database or fetched.
+type EventPower struct {
+	KillerGearIp float64
+	VictimGearIp float64
+	ItemIps      map[Item]float64
+}
+
+func buildSlotItems(build Build, filter BuildFilter) []SlotItem {
+	var slotItems []SlotItem
+	add := func(enabled bool, slot string, item Item) {
+		if enabled && item.Name != "" {
+			slotItems = append(slotItems, SlotItem{Slot: slot, Item: item})
+		}
+	}
+	add(filter.MainHand, "Weapon", build.MainHand)
+	add(filter.OffHand, "Off Hand", build.OffHand)
+	add(filter.Head, "Head", build.Head)
+	add(filter.Chest, "Chest", build.Chest)
+	add(filter.Foot, "Foot", build.Foot)
+	add(filter.Cape, "Cape", build.Cape)
+	add(filter.Potion, "Potion", build.Potion)
+	add(filter.Food, "Food", build.Food)
+	add(filter.Mount, "Mount", build.Mount)
+	add(filter.Bag, "Bag", build.Bag)
+	return slotItems
+}
+
+func eventDay(timestamp time.Time) string {
+	return timestamp.UTC().Format(time.DateOnly)
+}
+
+func bucketIpDifference(difference float64) float64 {
+	return math.Round(difference/ipDifferenceBucket) * ipDifferenceBucket
+}
+
+// buildKey joins the exact items of every slot in the order of BuildNamesOnly, quality left out. The
+// build report rolls these up to whatever build key spec it is asked for.
+func buildKey(build Build) string {
+	var parts []string
+	for _, item := range []Item{
+		build.MainHand, build.OffHand, build.Head, build.Chest, build.Foot,
+		build.Cape, build.Potion, build.Food, build.Mount, build.Bag,
+	} {
+		parts = append(parts, itemToTypeString(Item{Name: item.Name, Tier: item.Tier, Enchantment: item.Enchantment}))
+	}
+	return strings.Join(parts, "|")
+}
+
+func parseBuildKey(key string) (Build, error) {
+	parts := strings.Split(key, "|")
+	if len(parts) != 10 {
+		return Build{}, fmt.Errorf("invalid build key: %s", key)
+	}
+	var items []Item
+	for _, part := range parts {
+		item, err := typeStringToItem(part, 0)
+		if err != nil {
+			return Build{}, err
+		}
+		items = append(items, item)
+	}
+	return Build{
+		MainHand: items[0],
+		OffHand:  items[1],
+		Head:     items[2],
+		Chest:    items[3],
+		Foot:     items[4],
+		Cape:     items[5],
+		Potion:   items[6],
+		Food:     items[7],
+		Mount:    items[8],
+		Bag:      items[9],
+	}, nil
+}
+
+func eventPower(event Event) EventPower {
+	power := EventPower{
+		KillerGearIp: buildItemPower(event.KillerBuild),
+		VictimGearIp: buildItemPower(event.VictimBuild),
+		ItemIps:      make(map[Item]float64),
+	}
+	for _, item := range getItemsFromBuilds([]Build{event.KillerBuild, event.VictimBuild}, reportBuildFilter) {
+		power.ItemIps[item] = itemPower(item)
+	}
+	return power
+}
+
+func eventPowers(events []Event) []EventPower {
+	powers := make([]EventPower, len(events))
+	for i, event := range events {
+		if event.NumberOfParticipants == 1 {
+			powers[i] = eventPower(event)
+		}
+	}
+	return powers
+}
+
+// priceValueItems returns the prices of every item counted in a daily values table, or in the rows
+// matching the condition, with estimates filled in
+func priceValueItems(table string, valuation Valuation, condition string, args ...any) (map[Item]float64, map[Item]string, error) {
+	items, err := queryValueItems(table, condition, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	itemPrices, err := getItemPrices(items, valuation)
+	if err != nil {
+		log.Debug("Failed to get some prices for aggregated items: ", err)
+	}
+	estimatedPrices := estimateMissingPrices(items, itemPrices, valuation)
+	return itemPrices, estimatedPrices, nil
+}
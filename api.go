@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -18,369 +19,163 @@ type ItemStats struct {
 	SumAverageIp float64
 }
 
+type ItemPowerStats struct {
+	SumItemIp  float64
+	SumGearIp  float64
+	SumMastery float64
+	Usages     int64
+}
+
 type BuildStats struct {
 	SilverGained float64
 	SilverLost   float64
 	Kills        int64
 	Deaths       int64
 	SumAverageIp float64
-	Prices       []float64
+	OwnValue     float64
+	Estimated    int64
 }
 
-func generateItemReport() ([][]string, error) {
-	response := [][]string{}
+// buildSlotColumns are the slot columns of the build reports, in the order of BuildSlotKeys
+var buildSlotColumns = []string{"main_hand", "off_hand", "head", "chest", "foot", "cape", "food", "potion", "mount", "bag"}
+
+var buildStatsColumns = []string{
+	"usages",
+	"average_ip",
+	"k/d",
+	"silver_ratio",
+	"kills",
+	"deaths",
+	"silver_gained",
+	"silver_lost",
+	"estimated_values",
+}
 
-	// get all events
-	events, err := queryAllEvents()
-	if err != nil {
-		log.Error("Failed to query all events: ", err)
-		return response, err
-	}
+func (stats BuildStats) add(other BuildStats) BuildStats {
+	stats.SilverGained += other.SilverGained
+	stats.SilverLost += other.SilverLost
+	stats.Kills += other.Kills
+	stats.Deaths += other.Deaths
+	stats.SumAverageIp += other.SumAverageIp
+	stats.OwnValue += other.OwnValue
+	stats.Estimated += other.Estimated
+	return stats
+}
 
-	// filter for solo events
-	var solo_events []Event
-	for _, event := range events {
-		if event.NumberOfParticipants == 1 {
-			solo_events = append(solo_events, event)
-		}
-	}
-	events = solo_events
+// averageValue is the average worth of the build's own gear, zero when none of it has a price
+func (stats BuildStats) averageValue() float64 {
+	return stats.OwnValue / math.Max(float64(stats.Kills+stats.Deaths), 1.0)
+}
 
-	// get all builds
-	var builds []Build
-	for _, event := range events {
-		builds = append(builds, event.KillerBuild, event.VictimBuild)
+// columns formats the stats in the order of buildStatsColumns
+func (stats BuildStats) columns() []string {
+	price := stats.averageValue()
+	if price == 0.0 {
+		price = math.Inf(1)
 	}
-
-	// get all items
-	var buildFilter = BuildFilter{
-		MainHand: true,
-		OffHand:  true,
-		Head:     true,
-		Chest:    true,
-		Foot:     true,
-		Cape:     true,
-		Potion:   false,
-		Food:     false,
-		Mount:    false,
-		Bag:      false,
+	return []string{
+		fmt.Sprintf("%d", stats.Kills+stats.Deaths),
+		fmt.Sprintf("%f", stats.SumAverageIp/float64(stats.Kills+stats.Deaths)),
+		fmt.Sprintf("%f", float64(stats.Kills)/math.Max(float64(stats.Deaths), 1.0)),
+		fmt.Sprintf("%f", stats.SilverGained/math.Max(math.Max(stats.SilverLost, 1.0), price)),
+		fmt.Sprintf("%d", stats.Kills),
+		fmt.Sprintf("%d", stats.Deaths),
+		fmt.Sprintf("%f", stats.SilverGained),
+		fmt.Sprintf("%f", stats.SilverLost),
+		fmt.Sprintf("%d", stats.Estimated),
 	}
-	items := getItemsFromBuilds(builds, buildFilter)
+}
 
-	// get their prices
-	itemPrices, _ := getItemPrices(items)
+type ItemReportOptions struct {
+	Valuation Valuation
+	GroupBy   string
+	Language  string
+	IpBasis   string
+	// Item narrows the report to the one item when set
+	Item Item
+}
+
+func generateItemReport(options ItemReportOptions, out RowWriter) error {
+	valuation := options.Valuation
+
+	// get the daily aggregates of solo events
+	itemAggregates, err := queryItemAggregates()
+	if err != nil {
+		log.Error("Failed to query item aggregates: ", err)
+		return err
+	}
 
-	// get build prices
-	buildPrices := getBuildPrices(builds, itemPrices, buildFilter)
+	// price everything the items killed, died with or were
+	condition, args := itemValueCondition(options.Item)
+	itemPrices, estimatedPrices, err := priceValueItems("item_daily_values", valuation, condition, args...)
+	if err != nil {
+		log.Error("Failed to price item values: ", err)
+		return err
+	}
 
-	//
 	itemsToStats := make(map[Item]ItemStats)
-	for _, event := range events {
-		if buildPrices[event.VictimBuild] == 0.0 {
+	itemsToEstimatedValues := make(map[Item]int64)
+	itemsToItemPower := make(map[Item]ItemPowerStats)
+	for item, aggregate := range itemAggregates {
+		if options.Item.Name != "" && item != equivalentItem(options.Item) {
 			continue
 		}
-		if buildFilter.MainHand {
-			if event.KillerBuild.MainHand.Name != "" {
-				item := event.KillerBuild.MainHand
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Weapon"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.MainHand.Name != "" {
-				item := event.VictimBuild.MainHand
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Weapon"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
-		}
-		if buildFilter.OffHand {
-			if event.KillerBuild.OffHand.Name != "" {
-				item := event.KillerBuild.OffHand
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Off Hand"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.OffHand.Name != "" {
-				item := event.VictimBuild.OffHand
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Off Hand"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
-		}
-		if buildFilter.Head {
-			if event.KillerBuild.Head.Name != "" {
-				item := event.KillerBuild.Head
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Head"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Head.Name != "" {
-				item := event.VictimBuild.Head
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Head"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
-		}
-		if buildFilter.Chest {
-			if event.KillerBuild.Chest.Name != "" {
-				item := event.KillerBuild.Chest
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Chest"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Chest.Name != "" {
-				item := event.VictimBuild.Chest
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Chest"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
+		itemsToStats[item] = ItemStats{
+			Kills:        aggregate.Kills,
+			Deaths:       aggregate.Deaths,
+			Slot:         aggregate.Slot,
+			SumAverageIp: aggregate.SumAverageIp,
 		}
-		if buildFilter.Foot {
-			if event.KillerBuild.Foot.Name != "" {
-				item := event.KillerBuild.Foot
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Foot"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Foot.Name != "" {
-				item := event.VictimBuild.Foot
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Foot"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
-		}
-		if buildFilter.Cape {
-			if event.KillerBuild.Cape.Name != "" {
-				item := event.KillerBuild.Cape
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Cape"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Cape.Name != "" {
-				item := event.VictimBuild.Cape
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Cape"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
+
+		// item power of the item itself and of the whole gear, next to the reported average
+		itemsToItemPower[item] = ItemPowerStats{
+			SumItemIp:  aggregate.SumItemIp,
+			SumGearIp:  aggregate.SumGearIp,
+			SumMastery: aggregate.SumMastery,
+			Usages:     aggregate.Kills + aggregate.Deaths,
 		}
-		if buildFilter.Potion {
-			if event.KillerBuild.Potion.Name != "" {
-				item := event.KillerBuild.Potion
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Potion"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Potion.Name != "" {
-				item := event.VictimBuild.Potion
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Potion"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
+	}
+
+	// add up silver as the value counts are read
+	err = forEachItemValue(options.Item, func(item Item, value ValueCount) error {
+		stats, found := itemsToStats[item]
+		if !found {
+			return nil
 		}
-		if buildFilter.Food {
-			if event.KillerBuild.Food.Name != "" {
-				item := event.KillerBuild.Food
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Food"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Food.Name != "" {
-				item := event.VictimBuild.Food
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Food"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
+		switch value.Outcome {
+		case OutcomeGained:
+			stats.SilverGained += itemPrices[value.Item] * float64(value.Count)
+		case OutcomeLost:
+			stats.SilverLost += itemPrices[value.Item] * float64(value.Count)
+		default:
+			return nil
 		}
-		if buildFilter.Mount {
-			if event.KillerBuild.Mount.Name != "" {
-				item := event.KillerBuild.Mount
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Mount"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Mount.Name != "" {
-				item := event.VictimBuild.Mount
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Mount"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
+		if estimatedPrices[value.Item] != "" {
+			itemsToEstimatedValues[item] += value.Count
 		}
-		if buildFilter.Bag {
-			if event.KillerBuild.Bag.Name != "" {
-				item := event.KillerBuild.Bag
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverGained += buildPrices[event.VictimBuild]
-				stats.Kills += 1
-				if stats.Slot == "" {
-					stats.Slot = "Bag"
-				}
-				stats.SumAverageIp += event.KillerAverageIp
-				itemsToStats[item] = stats
-			}
-			if event.VictimBuild.Bag.Name != "" {
-				item := event.VictimBuild.Bag
-				item.Quality = 0
-				item.Tier = item.Tier + item.Enchantment
-				item.Enchantment = 0
-				stats := itemsToStats[item]
-				stats.SilverLost += buildPrices[event.VictimBuild]
-				stats.Deaths += 1
-				if stats.Slot == "" {
-					stats.Slot = "Bag"
-				}
-				stats.SumAverageIp += event.VictimAverageIp
-				itemsToStats[item] = stats
-			}
+		itemsToStats[item] = stats
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to read item values: ", err)
+		return err
+	}
 
-		}
+	// wins and losses against the ip difference of each fight
+	itemsToMatchups, err := queryItemMatchups(options.IpBasis)
+	if err != nil {
+		log.Error("Failed to query item matchups: ", err)
+		return err
+	}
+	fights, err := queryIpDifferences(options.IpBasis)
+	if err != nil {
+		log.Error("Failed to query ip differences: ", err)
+		return err
+	}
+	ipCoefficient := fitIpCoefficient(fights)
 
+	if options.GroupBy != GroupByItem {
+		return generateRollupReport(itemsToStats, itemsToEstimatedValues, options.GroupBy, out)
 	}
 
 	// get human readable
@@ -388,25 +183,38 @@ func generateItemReport() ([][]string, error) {
 	for item := range itemsToStats {
 		itemsThatHaveStats = append(itemsThatHaveStats, item)
 	}
-	humanReadableNamesBatch, err := manyToHumanReadable(itemsThatHaveStats)
+	humanReadableNamesBatch, err := manyToHumanReadable(itemsThatHaveStats, options.Language)
 	if err != nil {
 		log.Error("Failed to fetch some human readable names during report generation: ", err)
 	}
 
 	// format to csv
-	response = append(response, []string{
+	err = out.Write([]string{
 		"item_id",
 		"slot",
 		"equivalence",
+		"category",
+		"subcategory",
+		"artifact",
 		"usages",
 		"average_build_ip",
+		"average_item_ip",
+		"average_gear_ip",
+		"average_implied_mastery",
 		"k/d",
+		"win_rate",
+		"expected_win_rate",
+		"ip_adjusted_effect",
 		"silver_ratio",
 		"kills",
 		"deaths",
 		"silver_gained",
 		"silver_lost",
+		"estimated_values",
 	})
+	if err != nil {
+		return err
+	}
 	for item, stats := range itemsToStats {
 
 		var itemVersionPrices []float64
@@ -425,202 +233,422 @@ func generateItemReport() ([][]string, error) {
 		if medianPrice == 0.0 {
 			medianPrice = math.Inf(1)
 		}
-		response = append(response, []string{
+		meta, _ := itemMetaFor(item)
+		powerStats := itemsToItemPower[item]
+		winRate, expectedWinRate, effect := itemEffect(itemsToMatchups[item], ipCoefficient)
+		err := out.Write([]string{
 			humanReadableNamesBatch[item.Name],
 			stats.Slot,
 			fmt.Sprintf("%d", item.Tier),
+			meta.Category,
+			meta.Subcategory,
+			fmt.Sprintf("%t", meta.Artifact),
 			fmt.Sprintf("%d", stats.Kills+stats.Deaths),
 			fmt.Sprintf("%f", stats.SumAverageIp/float64(stats.Kills+stats.Deaths)),
+			fmt.Sprintf("%f", powerStats.SumItemIp/math.Max(float64(powerStats.Usages), 1.0)),
+			fmt.Sprintf("%f", powerStats.SumGearIp/math.Max(float64(powerStats.Usages), 1.0)),
+			fmt.Sprintf("%f", powerStats.SumMastery/math.Max(float64(powerStats.Usages), 1.0)),
 			fmt.Sprintf("%f", float64(stats.Kills)/math.Max(float64(stats.Deaths), 1.0)),
+			fmt.Sprintf("%f", winRate),
+			fmt.Sprintf("%f", expectedWinRate),
+			fmt.Sprintf("%f", effect),
 			fmt.Sprintf("%f", stats.SilverGained*0.7/math.Max(math.Max(stats.SilverLost, 1.0), medianPrice)),
 			fmt.Sprintf("%d", stats.Kills),
 			fmt.Sprintf("%d", stats.Deaths),
 			fmt.Sprintf("%f", stats.SilverGained*0.7),
 			fmt.Sprintf("%f", stats.SilverLost),
+			fmt.Sprintf("%d", itemsToEstimatedValues[item]),
 		})
+		if err != nil {
+			return err
+		}
 	}
 
-	return response, nil
+	return nil
 }
 
-// Handler function for the endpoint
-func itemReportHandler(w http.ResponseWriter, _ *http.Request) {
-	// Create a response in CSV format
-	response, _ := generateItemReport()
+func cachedItemReport(options ItemReportOptions) (CachedReport, error) {
+	return cachedReport(reportCacheKey("itemReport", options), func(out RowWriter) error {
+		return generateItemReport(options, out)
+	})
+}
 
-	// Encode and send the CSV response
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=itemReport-%d.csv", time.Now().Unix()))
-	writer := csv.NewWriter(w)
-	for _, record := range response {
-		if err := writer.Write(record); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// Handler function for the endpoint
+func itemReportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	valuation, err := valuationFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	groupBy := GroupByItem
+	if query.Has("groupBy") {
+		groupBy = query.Get("groupBy")
+	}
+	if err := validateGroupBy(groupBy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	ipBasis := IpBasisReported
+	if query.Has("ipBasis") {
+		ipBasis = query.Get("ipBasis")
+	}
+	if err := validateIpBasis(ipBasis); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := formatFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := ItemReportOptions{
+		Valuation: valuation,
+		GroupBy:   groupBy,
+		Language:  language,
+		IpBasis:   ipBasis,
+	}
+	serveReport(w, r, "itemReport", reportCacheKey("itemReport", options), format, page, func(out RowWriter) error {
+		return generateItemReport(options, out)
+	})
 }
 
-func generateBuildReport() ([][]string, error) {
-	response := [][]string{}
+// getStoredBuildStats reads the build aggregates and prices them, keyed by the stored build key
+func getStoredBuildStats(valuation Valuation) (map[string]BuildStats, error) {
+	// get the daily aggregates of solo events
+	buildAggregates, err := queryBuildAggregates()
+	if err != nil {
+		log.Error("Failed to query build aggregates: ", err)
+		return nil, err
+	}
 
-	// get all events
-	events, err := queryAllEvents()
+	// price everything the builds killed, died with or wore
+	itemPrices, estimatedPrices, err := priceValueItems("build_daily_values", valuation, "")
 	if err != nil {
-		log.Error("Failed to query all events: ", err)
-		return response, err
+		log.Error("Failed to price build values: ", err)
+		return nil, err
 	}
 
-	// filter for solo events
-	var solo_events []Event
-	for _, event := range events {
-		if event.NumberOfParticipants == 1 {
-			solo_events = append(solo_events, event)
+	buildsToStats := make(map[string]BuildStats)
+	for key, aggregate := range buildAggregates {
+		buildsToStats[key] = BuildStats{
+			Kills:        aggregate.Kills,
+			Deaths:       aggregate.Deaths,
+			SumAverageIp: aggregate.SumAverageIp,
 		}
 	}
-	events = solo_events
 
-	// get all builds
-	var builds []Build
-	for _, event := range events {
-		builds = append(builds, event.KillerBuild, event.VictimBuild)
+	// add up silver as the value counts are read
+	err = forEachBuildValue(func(key string, value ValueCount) error {
+		stats, found := buildsToStats[key]
+		if !found {
+			return nil
+		}
+		price := itemPrices[value.Item] * float64(value.Count)
+		switch value.Outcome {
+		case OutcomeGained:
+			stats.SilverGained += price
+		case OutcomeLost:
+			stats.SilverLost += price
+		case OutcomeOwn:
+			stats.OwnValue += price
+		}
+		if value.Outcome != OutcomeOwn && estimatedPrices[value.Item] != "" {
+			stats.Estimated += value.Count
+		}
+		buildsToStats[key] = stats
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to read build values: ", err)
+		return nil, err
 	}
+	return buildsToStats, nil
+}
 
-	// get all items
-	var buildFilter = BuildFilter{
-		MainHand: true,
-		OffHand:  true,
-		Head:     true,
-		Chest:    true,
-		Foot:     true,
-		Cape:     true,
-		Potion:   false,
-		Food:     false,
-		Mount:    false,
-		Bag:      false,
+// getBuildStats rolls the priced stored builds up to the spec
+func getBuildStats(valuation Valuation, spec BuildKeySpec) (map[BuildSlotKeys]BuildStats, error) {
+	buildsToStats, err := getStoredBuildStats(valuation)
+	if err != nil {
+		return nil, err
 	}
-	items := getItemsFromBuilds(builds, buildFilter)
-
-	// get their prices
-	itemPrices, _ := getItemPrices(items)
-
-	// get build prices
-	buildPrices := getBuildPrices(builds, itemPrices, buildFilter)
 
-	//
-	buildsNamesOnlyToStats := make(map[BuildNamesOnly]BuildStats)
-	for _, event := range events {
-		if buildPrices[event.VictimBuild] == 0.0 {
+	// stored builds have every slot with its exact tier, roll them up to the requested spec
+	buildKeysToStats := make(map[BuildSlotKeys]BuildStats)
+	for key, stats := range buildsToStats {
+		build, err := parseBuildKey(key)
+		if err != nil {
+			log.Error("Failed to parse build key: ", err)
 			continue
 		}
-		killerBuildNamesOnly := buildToNamesOnly(event.KillerBuild, buildFilter)
-		victimBuildNamesOnly := buildToNamesOnly(event.VictimBuild, buildFilter)
-
-		killerBuildStats := buildsNamesOnlyToStats[killerBuildNamesOnly]
-		killerBuildStats.Kills += 1
-		killerBuildStats.SilverGained += buildPrices[event.VictimBuild]
-		killerBuildStats.SumAverageIp += event.KillerAverageIp
-		if buildPrices[event.KillerBuild] != 0.0 {
-			killerBuildStats.Prices = append(killerBuildStats.Prices, buildPrices[event.KillerBuild])
-		}
-		buildsNamesOnlyToStats[killerBuildNamesOnly] = killerBuildStats
-
-		victimBuildStats := buildsNamesOnlyToStats[victimBuildNamesOnly]
-		victimBuildStats.Deaths += 1
-		victimBuildStats.SilverLost += buildPrices[event.VictimBuild]
-		victimBuildStats.SumAverageIp += event.VictimAverageIp
-		if buildPrices[event.VictimBuild] != 0.0 {
-			victimBuildStats.Prices = append(victimBuildStats.Prices, buildPrices[event.VictimBuild])
-		}
-		buildsNamesOnlyToStats[victimBuildNamesOnly] = victimBuildStats
+		keys := spec.buildKeys(build)
+		buildKeysToStats[keys] = buildKeysToStats[keys].add(stats)
 	}
+	return buildKeysToStats, nil
+}
 
-	// get human readable
-	var batchBuildNamesOnly []BuildNamesOnly
-	for buildNameOnly, _ := range buildsNamesOnlyToStats {
-		batchBuildNamesOnly = append(batchBuildNamesOnly, buildNameOnly)
-	}
-	var itemsInBuilds = namesOnlyToItems(batchBuildNamesOnly, buildFilter)
-	humanReadableNamesBatch, err := manyToHumanReadable(itemsInBuilds)
+func generateBuildReport(valuation Valuation, language string, spec BuildKeySpec, out RowWriter) error {
+	buildKeysToStats, err := getBuildStats(valuation, spec)
 	if err != nil {
-		log.Error("Failed to fetch some human readable names during report generation: ", err)
+		return err
 	}
 
+	// get human readable
+	var builds []BuildSlotKeys
+	for keys := range buildKeysToStats {
+		builds = append(builds, keys)
+	}
+	names := buildKeyNames(builds, language)
+
 	// format to csv
-	response = append(response, []string{
-		"main_hand",
-		"off_hand",
-		"head",
-		"chest",
-		"foot",
-		"cape",
-		"food",
-		"potion",
-		"mount",
-		"bag",
-		"usages",
-		"average_ip",
-		"k/d",
-		"silver_ratio",
-		"kills",
-		"deaths",
-		"silver_gained",
-		"silver_lost",
-	})
-	for buildNamesOnly, stats := range buildsNamesOnlyToStats {
-		price := calculateMedian(stats.Prices)
-		if price == 0.0 {
-			price = math.Inf(1)
+	if err := out.Write(append(append([]string{}, buildSlotColumns...), buildStatsColumns...)); err != nil {
+		return err
+	}
+	for keys, stats := range buildKeysToStats {
+		if err := out.Write(append(spec.buildLabels(keys, names), stats.columns()...)); err != nil {
+			return err
 		}
-		response = append(response, []string{
-			humanReadableNamesBatch[buildNamesOnly.MainHand],
-			humanReadableNamesBatch[buildNamesOnly.OffHand],
-			humanReadableNamesBatch[buildNamesOnly.Head],
-			humanReadableNamesBatch[buildNamesOnly.Chest],
-			humanReadableNamesBatch[buildNamesOnly.Foot],
-			humanReadableNamesBatch[buildNamesOnly.Cape],
-			humanReadableNamesBatch[buildNamesOnly.Food],
-			humanReadableNamesBatch[buildNamesOnly.Potion],
-			humanReadableNamesBatch[buildNamesOnly.Mount],
-			humanReadableNamesBatch[buildNamesOnly.Bag],
-			fmt.Sprintf("%d", stats.Kills+stats.Deaths),
-			fmt.Sprintf("%f", stats.SumAverageIp/float64(stats.Kills+stats.Deaths)),
-			fmt.Sprintf("%f", float64(stats.Kills)/math.Max(float64(stats.Deaths), 1.0)),
-			fmt.Sprintf("%f", stats.SilverGained/math.Max(math.Max(stats.SilverLost, 1.0), price)),
-			fmt.Sprintf("%d", stats.Kills),
-			fmt.Sprintf("%d", stats.Deaths),
-			fmt.Sprintf("%f", stats.SilverGained),
-			fmt.Sprintf("%f", stats.SilverLost),
-		})
 	}
 
-	return response, nil
+	return nil
 }
 
 // Handler function for the endpoint
-func buildReportHandler(w http.ResponseWriter, _ *http.Request) {
-	// Create a response in CSV format
-	response, _ := generateBuildReport()
+func buildReportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	valuation, err := valuationFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := formatFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	spec, err := buildKeySpecFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := struct {
+		Valuation Valuation
+		Language  string
+		Spec      BuildKeySpec
+	}{valuation, language, spec}
+	serveReport(w, r, "buildReport", reportCacheKey("buildReport", options), format, page, func(out RowWriter) error {
+		return generateBuildReport(valuation, language, spec, out)
+	})
+}
+
+func writeCsvResponse(w http.ResponseWriter, name string, response [][]string) {
 	// Encode and send the CSV response
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=buildReport-%d.csv", time.Now().Unix()))
-	writer := csv.NewWriter(w)
-	for _, record := range response {
-		if err := writer.Write(record); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	writer := newResponseRowWriter(w, name, FormatCsv)
+	if err := writeRows(writer, response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writer.Flush(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func boolFromQuery(query url.Values, key string) (bool, error) {
+	if !query.Has(key) {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(query.Get(key))
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %s", key, query.Get(key))
+	}
+	return value, nil
+}
+
+// fractionFromQuery reads a number between 0 and 1
+func fractionFromQuery(query url.Values, key string, fallback float64) (float64, error) {
+	if !query.Has(key) {
+		return fallback, nil
+	}
+	value, err := strconv.ParseFloat(query.Get(key), 64)
+	if err != nil || value < 0.0 || value > 1.0 {
+		return 0.0, fmt.Errorf("invalid %s: %s", key, query.Get(key))
+	}
+	return value, nil
+}
+
+func intFromQuery(query url.Values, key string, fallback int) (int, error) {
+	if !query.Has(key) {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(query.Get(key))
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", key, query.Get(key))
+	}
+	return value, nil
+}
+
+func craftProfitHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	valuation, err := valuationFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var bonus CraftingBonus
+	if bonus.Focus, err = boolFromQuery(query, "focus"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bonus.CityBonus, err = boolFromQuery(query, "cityBonus"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rank := "margin"
+	if query.Has("rank") {
+		rank = query.Get("rank")
+	}
+	if rank != "margin" && rank != "demand" && rank != "profit" {
+		http.Error(w, fmt.Sprintf("invalid rank: %s", rank), http.StatusBadRequest)
+		return
+	}
+	limit, err := intFromQuery(query, "limit", config.CraftingCandidates)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := generateCraftProfitReport(valuation, bonus, rank, limit, language)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCsvResponse(w, "craftProfit", response)
+}
+
+func valuationFromQuery(query url.Values) (Valuation, error) {
+	valuation := defaultValuation()
+	if query.Has("valuation") {
+		valuation.Mode = query.Get("valuation")
+	}
+	if query.Has("city") {
+		valuation.City = query.Get("city")
+		if !query.Has("valuation") {
+			valuation.Mode = ValuationCity
+		}
+	}
+	return valuation, validateValuation(valuation)
+}
+
+func languageFromQuery(query url.Values) (string, error) {
+	return normalizeLanguage(query.Get("lang"))
+}
+
+type PriceBreakdownResponse struct {
+	Item       string             `json:"item"`
+	Name       string             `json:"name"`
+	Quality    uint8              `json:"quality"`
+	Cities     LocationPrices     `json:"cities"`
+	Valuations map[string]float64 `json:"valuations"`
+}
+
+func priceBreakdownHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var quality uint8
+	var err error
+	if query.Has("quality") {
+		quality, err = parseUint8(query.Get("quality"))
+		if err != nil {
+			http.Error(w, "Invalid quality", http.StatusBadRequest)
 			return
 		}
 	}
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	var items []Item
+	for _, typeString := range query["item"] {
+		item, err := typeStringToItem(typeString, quality)
+		if err != nil || item.Name == "" {
+			http.Error(w, fmt.Sprintf("Invalid item: %s", typeString), http.StatusBadRequest)
+			return
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		http.Error(w, "Missing item", http.StatusBadRequest)
 		return
 	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	itemLocationPrices, err := getItemLocationPrices(items)
+	if err != nil {
+		log.Debug("Failed to get some prices for breakdown: ", err)
+	}
+	humanReadableNamesBatch, err := manyToHumanReadable(items, language)
+	if err != nil {
+		log.Error("Failed to fetch some human readable names during price breakdown: ", err)
+	}
+
+	var responseData []PriceBreakdownResponse
+	for _, item := range items {
+		cities := itemLocationPrices[item]
+		if cities == nil {
+			cities = make(LocationPrices)
+		}
+		valuations := make(map[string]float64)
+		for _, mode := range []string{ValuationCheapest, ValuationMedian, ValuationBlackMarket} {
+			valuations[mode] = valuePrice(cities, Valuation{Mode: mode})
+		}
+		responseData = append(responseData, PriceBreakdownResponse{
+			Item:       itemToTypeString(item),
+			Name:       humanReadableNamesBatch[item.Name],
+			Quality:    item.Quality,
+			Cities:     cities,
+			Valuations: valuations,
+		})
+	}
+
+	// Marshal responseData into JSON format
+	responseJSON, err := json.Marshal(responseData)
+	if err != nil {
+		http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
 }
 
 type StatsResponse struct {
@@ -664,7 +692,17 @@ func statsHandler(w http.ResponseWriter, _ *http.Request) {
 func startAPI() {
 	http.HandleFunc("/itemReport", itemReportHandler)
 	http.HandleFunc("/buildReport", buildReportHandler)
+	http.HandleFunc("/buildClusters", buildClustersHandler)
+	http.HandleFunc("/pairReport", pairReportHandler)
+	http.HandleFunc("/synergy", synergyHandler)
+	http.HandleFunc("/recommend", recommendHandler)
+	http.HandleFunc("/counters", countersHandler)
+	http.HandleFunc("/weakTo", weakToHandler)
+	http.HandleFunc("/priceBreakdown", priceBreakdownHandler)
+	http.HandleFunc("/craftProfit", craftProfitHandler)
 	http.HandleFunc("/stats", statsHandler)
+	http.HandleFunc("/items/search", itemSearchHandler)
+	http.HandleFunc("/items/{type}", itemLookupHandler)
 	log.Info("Server starting on port ", config.Port, "...")
 	log.Error(http.ListenAndServe(fmt.Sprintf(":%d", config.Port), nil))
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	TierNone        = "none"
+	TierEquivalence = "equivalence"
+	TierExact       = "exact"
+)
+
+// BuildKeySpec decides which builds the build report counts as the same: the slots compared, how much
+// of the tier is kept, and whether armor only counts by weight class
+type BuildKeySpec struct {
+	Slots       BuildFilter
+	Tier        string
+	WeightClass bool
+}
+
+func defaultBuildKeySpec() BuildKeySpec {
+	return BuildKeySpec{Slots: reportBuildFilter, Tier: TierNone}
+}
+
+// slotFilter turns slot names as used in the build report columns into a filter
+func slotFilter(slots []string) (BuildFilter, error) {
+	var filter BuildFilter
+	for _, slot := range slots {
+		switch strings.TrimSpace(slot) {
+		case "main_hand":
+			filter.MainHand = true
+		case "off_hand":
+			filter.OffHand = true
+		case "head":
+			filter.Head = true
+		case "chest":
+			filter.Chest = true
+		case "foot":
+			filter.Foot = true
+		case "cape":
+			filter.Cape = true
+		case "potion":
+			filter.Potion = true
+		case "food":
+			filter.Food = true
+		case "mount":
+			filter.Mount = true
+		case "bag":
+			filter.Bag = true
+		default:
+			return filter, fmt.Errorf("invalid slot: %s", slot)
+		}
+	}
+	return filter, nil
+}
+
+func buildKeySpecFromQuery(query url.Values) (BuildKeySpec, error) {
+	spec := defaultBuildKeySpec()
+	if query.Has("slots") {
+		slots, err := slotFilter(strings.Split(query.Get("slots"), ","))
+		if err != nil {
+			return spec, err
+		}
+		spec.Slots = slots
+	}
+	if query.Has("tier") {
+		spec.Tier = query.Get("tier")
+	}
+	if spec.Tier != TierNone && spec.Tier != TierEquivalence && spec.Tier != TierExact {
+		return spec, fmt.Errorf("invalid tier: %s", spec.Tier)
+	}
+	weightClass, err := boolFromQuery(query, "weightClass")
+	if err != nil {
+		return spec, err
+	}
+	spec.WeightClass = weightClass
+	return spec, nil
+}
+
+// SlotKey is what builds are grouped by in a slot: the item name, or the weight class for armor, with as
+// much of the tier as the spec keeps. It is the same in every language, labels are made from it when a
+// row is written.
+type SlotKey struct {
+	Name        string
+	Tier        uint8
+	Enchantment uint8
+	WeightClass string
+}
+
+// BuildSlotKeys keys a build slot by slot, in the order of buildSlotColumns
+type BuildSlotKeys [10]SlotKey
+
+func (key SlotKey) empty() bool {
+	return key == SlotKey{}
+}
+
+// String is a type string like form of the key, used to order keys the same way every time
+func (key SlotKey) String() string {
+	name := key.Name
+	if key.WeightClass != "" {
+		name = key.WeightClass
+	}
+	return itemToTypeString(Item{Name: name, Tier: key.Tier, Enchantment: key.Enchantment})
+}
+
+func (keys BuildSlotKeys) String() string {
+	var slots []string
+	for _, key := range keys {
+		slots = append(slots, key.String())
+	}
+	return strings.Join(slots, "|")
+}
+
+func (spec BuildKeySpec) slotKey(item Item, armor bool) SlotKey {
+	if item.Name == "" {
+		return SlotKey{}
+	}
+	key := SlotKey{Name: item.Name}
+	if armor && spec.WeightClass {
+		if class := weightClass(item); class != "" {
+			key = SlotKey{WeightClass: class}
+		}
+	}
+	if item.Tier == 0 {
+		return key
+	}
+	switch spec.Tier {
+	case TierExact:
+		key.Tier, key.Enchantment = item.Tier, item.Enchantment
+	case TierEquivalence:
+		key.Tier = equivalentItem(item).Tier
+	}
+	return key
+}
+
+// buildKeys keys a build by the spec, slots the spec leaves out stay empty
+func (spec BuildKeySpec) buildKeys(build Build) BuildSlotKeys {
+	key := func(enabled bool, item Item, armor bool) SlotKey {
+		if !enabled {
+			return SlotKey{}
+		}
+		return spec.slotKey(item, armor)
+	}
+	return BuildSlotKeys{
+		key(spec.Slots.MainHand, build.MainHand, false),
+		key(spec.Slots.OffHand, build.OffHand, false),
+		key(spec.Slots.Head, build.Head, true),
+		key(spec.Slots.Chest, build.Chest, true),
+		key(spec.Slots.Foot, build.Foot, true),
+		key(spec.Slots.Cape, build.Cape, false),
+		key(spec.Slots.Food, build.Food, false),
+		key(spec.Slots.Potion, build.Potion, false),
+		key(spec.Slots.Mount, build.Mount, false),
+		key(spec.Slots.Bag, build.Bag, false),
+	}
+}
+
+// slotLabel is how a key shows in the reports, like "8.3 Claymore" with exact tiers
+func (spec BuildKeySpec) slotLabel(key SlotKey, names map[string]string) string {
+	if key.empty() {
+		return ""
+	}
+	label := key.WeightClass
+	if label == "" {
+		label = names[key.Name]
+	}
+	if label == "" {
+		label = key.Name
+	}
+	if key.Tier == 0 {
+		return label
+	}
+	switch spec.Tier {
+	case TierExact:
+		return fmt.Sprintf("%d.%d %s", key.Tier, key.Enchantment, label)
+	case TierEquivalence:
+		return fmt.Sprintf("eq%d %s", key.Tier, label)
+	}
+	return label
+}
+
+func (spec BuildKeySpec) buildLabels(keys BuildSlotKeys, names map[string]string) []string {
+	labels := make([]string, len(keys))
+	for slot, key := range keys {
+		labels[slot] = spec.slotLabel(key, names)
+	}
+	return labels
+}
+
+// slotKeyNames looks up the display names of the items behind the keys
+func slotKeyNames(keys []SlotKey, language string) map[string]string {
+	var items []Item
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if key.Name != "" && !seen[key.Name] {
+			seen[key.Name] = true
+			items = append(items, Item{Name: key.Name})
+		}
+	}
+	names, err := manyToHumanReadable(items, language)
+	if err != nil {
+		log.Error("Failed to fetch some human readable names during report generation: ", err)
+	}
+	return names
+}
+
+// buildKeyNames looks up the display names of every item in the builds
+func buildKeyNames(builds []BuildSlotKeys, language string) map[string]string {
+	var keys []SlotKey
+	for _, build := range builds {
+		keys = append(keys, build[:]...)
+	}
+	return slotKeyNames(keys, language)
+}
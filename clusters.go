@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// buildSlotWeights is how much each slot counts towards build similarity, in the order of
+// buildSlotColumns. The weapon decides the most about how a build plays, mounts and bags the least.
+var buildSlotWeights = []float64{4.0, 1.0, 1.0, 2.0, 1.0, 0.5, 0.5, 0.5, 0.25, 0.25}
+
+// with the default weights builds with different weapons never reach this
+const defaultClusterSimilarity = 0.75
+
+const (
+	ClusterRowCluster = "cluster"
+	ClusterRowMember  = "member"
+)
+
+type ClusterMember struct {
+	Keys  BuildSlotKeys
+	Stats BuildStats
+}
+
+type BuildCluster struct {
+	Leader  BuildSlotKeys
+	Members []ClusterMember
+	Stats   BuildStats
+}
+
+func (member ClusterMember) usages() int64 {
+	return member.Stats.Kills + member.Stats.Deaths
+}
+
+// buildSimilarity is the weighted share of slots two builds have in common, slots both leave empty
+// don't count
+func buildSimilarity(a BuildSlotKeys, b BuildSlotKeys) float64 {
+	matched, total := 0.0, 0.0
+	for slot := range a {
+		if a[slot].empty() && b[slot].empty() {
+			continue
+		}
+		total += buildSlotWeights[slot]
+		if a[slot] == b[slot] {
+			matched += buildSlotWeights[slot]
+		}
+	}
+	if total == 0.0 {
+		return 1.0
+	}
+	return matched / total
+}
+
+// clusterBuilds groups builds around the most used ones. Builds are taken by usages, each joining the
+// cluster whose leader it is most similar to, or leading a new cluster when none reach the similarity.
+func clusterBuilds(buildsToStats map[BuildSlotKeys]BuildStats, similarity float64) []BuildCluster {
+	type entry struct {
+		keys  BuildSlotKeys
+		key   string
+		stats BuildStats
+	}
+	var entries []entry
+	for keys, stats := range buildsToStats {
+		entries = append(entries, entry{keys: keys, key: keys.String(), stats: stats})
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		usagesA := entries[a].stats.Kills + entries[a].stats.Deaths
+		usagesB := entries[b].stats.Kills + entries[b].stats.Deaths
+		if usagesA != usagesB {
+			return usagesA > usagesB
+		}
+		return entries[a].key < entries[b].key
+	})
+
+	var clusters []BuildCluster
+	for _, entry := range entries {
+		best, bestSimilarity := -1, similarity
+		for i, cluster := range clusters {
+			if candidate := buildSimilarity(entry.keys, cluster.Leader); candidate > bestSimilarity || (best == -1 && candidate == bestSimilarity) {
+				best, bestSimilarity = i, candidate
+			}
+		}
+		if best == -1 {
+			clusters = append(clusters, BuildCluster{Leader: entry.keys})
+			best = len(clusters) - 1
+		}
+		clusters[best].Members = append(clusters[best].Members, ClusterMember{Keys: entry.keys, Stats: entry.stats})
+		clusters[best].Stats = clusters[best].Stats.add(entry.stats)
+	}
+	return clusters
+}
+
+// archetype is the most used item of each slot across the members, ties going to the first by name
+func (cluster BuildCluster) archetype() BuildSlotKeys {
+	var archetype BuildSlotKeys
+	for slot := range archetype {
+		slotUsages := make(map[SlotKey]int64)
+		for _, member := range cluster.Members {
+			slotUsages[member.Keys[slot]] += member.usages()
+		}
+		best := int64(-1)
+		for key, usages := range slotUsages {
+			if usages > best || (usages == best && key.String() < archetype[slot].String()) {
+				archetype[slot], best = key, usages
+			}
+		}
+	}
+	return archetype
+}
+
+// cohesion is the usage weighted similarity of the members to the archetype
+func (cluster BuildCluster) cohesion(archetype BuildSlotKeys) float64 {
+	sum, usages := 0.0, int64(0)
+	for _, member := range cluster.Members {
+		sum += buildSimilarity(member.Keys, archetype) * float64(member.usages())
+		usages += member.usages()
+	}
+	if usages == 0 {
+		return 0.0
+	}
+	return sum / float64(usages)
+}
+
+func generateBuildClusterReport(valuation Valuation, language string, spec BuildKeySpec, similarity float64, out RowWriter) error {
+	buildKeysToStats, err := getBuildStats(valuation, spec)
+	if err != nil {
+		return err
+	}
+	clusters := clusterBuilds(buildKeysToStats, similarity)
+
+	// get human readable
+	var builds []BuildSlotKeys
+	for keys := range buildKeysToStats {
+		builds = append(builds, keys)
+	}
+	names := buildKeyNames(builds, language)
+
+	// every cluster is a row with its archetype and combined stats, followed by a row for each member
+	// build with its own stats and its similarity to the archetype as cohesion
+	header := append([]string{"cluster", "row"}, buildSlotColumns...)
+	header = append(header, "members", "cohesion")
+	if err := out.Write(append(header, buildStatsColumns...)); err != nil {
+		return err
+	}
+	for i, cluster := range clusters {
+		id := fmt.Sprintf("%d", i+1)
+		archetype := cluster.archetype()
+		row := append([]string{id, ClusterRowCluster}, spec.buildLabels(archetype, names)...)
+		row = append(row, fmt.Sprintf("%d", len(cluster.Members)), fmt.Sprintf("%f", cluster.cohesion(archetype)))
+		if err := out.Write(append(row, cluster.Stats.columns()...)); err != nil {
+			return err
+		}
+		for _, member := range cluster.Members {
+			row := append([]string{id, ClusterRowMember}, spec.buildLabels(member.Keys, names)...)
+			row = append(row, "1", fmt.Sprintf("%f", buildSimilarity(member.Keys, archetype)))
+			if err := out.Write(append(row, member.Stats.columns()...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func buildClustersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	valuation, err := valuationFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := formatFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// each cluster followed by its members unless asked otherwise
+	if !query.Has("sort") {
+		query.Set("sort", "cluster")
+		if !query.Has("order") {
+			query.Set("order", OrderAsc)
+		}
+	}
+	page, err := pageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spec, err := buildKeySpecFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	similarity, err := fractionFromQuery(query, "similarity", defaultClusterSimilarity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := struct {
+		Valuation  Valuation
+		Language   string
+		Spec       BuildKeySpec
+		Similarity float64
+	}{valuation, language, spec, similarity}
+	serveReport(w, r, "buildClusters", reportCacheKey("buildClusters", options), format, page, func(out RowWriter) error {
+		return generateBuildClusterReport(valuation, language, spec, similarity, out)
+	})
+}
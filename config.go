@@ -13,11 +13,42 @@ type Config struct {
 	Database             string        `toml:"database"`
 	KillEventUrl         string        `toml:"albion_event_url"`
 	PriceUrl             string        `toml:"albion_online_data_url"`
+	CurrentPriceUrl      string        `toml:"albion_online_data_current_url"`
 	ItemNamesUrl         string        `toml:"item_names_url"`
+	ItemLocalizedUrl     string        `toml:"item_localized_names_url"`
+	ItemNamesFile        string        `toml:"item_names_file"`
+	ItemNamesRefresh     time.Duration `toml:"item_names_refresh"`
+	DefaultLanguage      string        `toml:"default_language"`
+	ItemDataUrl          string        `toml:"item_data_url"`
+	ItemDataRefresh      time.Duration `toml:"item_data_refresh"`
+	PriceSources         []string      `toml:"price_sources"`
+	PriceFile            string        `toml:"price_file"`
 	PriceLocations       []string      `toml:"price_locations"`
+	BlackMarketLocation  string        `toml:"black_market_location"`
+	PriceValuation       string        `toml:"price_valuation"`
+	PriceValuationCity   string        `toml:"price_valuation_city"`
+	PriceEstimator       string        `toml:"price_estimator"`
+	PriceTrimFraction    float64       `toml:"price_trim_fraction"`
+	PriceMadThreshold    float64       `toml:"price_mad_threshold"`
+	PriceRecencyHalfLife time.Duration `toml:"price_recency_half_life"`
+	PriceEstimateMissing bool          `toml:"price_estimate_missing"`
+	PriceLevelGrowth     float64       `toml:"price_level_growth"`
+	PriceRequestRate     int           `toml:"price_requests_per_minute"`
+	PriceConcurrency     int           `toml:"price_request_concurrency"`
 	PriceStaleThreshold  time.Duration `toml:"price_stale_threshold"`
+	PriceRefreshInterval time.Duration `toml:"price_refresh_interval"`
+	PriceRefreshMargin   time.Duration `toml:"price_refresh_margin"`
+	PriceRefreshItems    int           `toml:"price_refresh_items"`
+	PriceRefreshBudget   int           `toml:"price_refresh_budget"`
+	PriceRefreshRetry    time.Duration `toml:"price_refresh_retry"`
+	CraftingBaseBonus    float64       `toml:"crafting_base_bonus"`
+	CraftingFocusBonus   float64       `toml:"crafting_focus_bonus"`
+	CraftingCityBonus    float64       `toml:"crafting_city_bonus"`
+	CraftingCandidates   int           `toml:"crafting_candidates"`
 	EventStaleThreshold  time.Duration `toml:"event_stale_threshold"`
 	EventCleanupInterval time.Duration `toml:"event_cleanup_interval"`
+	ReportCacheTtl       time.Duration `toml:"report_cache_ttl"`
+	ReportCacheSize      int           `toml:"report_cache_size"`
 	LogFile              string        `toml:"log_file"`
 	LogLevel             logrus.Level  `toml:"log_level"`
 	PollEvents           bool          `toml:"poll_events"`
@@ -29,11 +60,42 @@ func defaultConfig() Config {
 		Database:             "amt.sqlite",
 		KillEventUrl:         "https://gameinfo.albiononline.com/api/gameinfo/events",
 		PriceUrl:             "https://old.west.albion-online-data.com/api/v2/stats/History",
+		CurrentPriceUrl:      "https://old.west.albion-online-data.com/api/v2/stats/Prices",
 		ItemNamesUrl:         "https://raw.githubusercontent.com/ao-data/ao-bin-dumps/master/formatted/items.txt",
+		ItemLocalizedUrl:     "https://raw.githubusercontent.com/ao-data/ao-bin-dumps/master/formatted/items.json",
+		ItemNamesFile:        "",
+		ItemNamesRefresh:     time.Duration(24) * time.Hour,
+		DefaultLanguage:      LanguageEnglish,
+		ItemDataUrl:          "https://raw.githubusercontent.com/ao-data/ao-bin-dumps/master/items.json",
+		ItemDataRefresh:      time.Duration(24) * time.Hour,
+		PriceSources:         []string{PriceSourceHistory, PriceSourceCurrent},
+		PriceFile:            "",
 		PriceLocations:       []string{"Lymhurst", "Thetford", "FortSterling", "Martlock", "Bridgewatch"},
+		BlackMarketLocation:  "BlackMarket",
+		PriceValuation:       ValuationCheapest,
+		PriceValuationCity:   "",
+		PriceEstimator:       EstimatorMadMedian,
+		PriceTrimFraction:    0.1,
+		PriceMadThreshold:    3.0,
+		PriceRecencyHalfLife: time.Duration(48) * time.Hour,
+		PriceEstimateMissing: true,
+		PriceLevelGrowth:     2.0,
+		PriceRequestRate:     90,
+		PriceConcurrency:     4,
 		PriceStaleThreshold:  time.Duration(7*24) * time.Hour,
+		PriceRefreshInterval: time.Duration(1) * time.Hour,
+		PriceRefreshMargin:   time.Duration(24) * time.Hour,
+		PriceRefreshItems:    1000,
+		PriceRefreshBudget:   10,
+		PriceRefreshRetry:    time.Duration(24) * time.Hour,
+		CraftingBaseBonus:    0.18,
+		CraftingFocusBonus:   0.59,
+		CraftingCityBonus:    0.15,
+		CraftingCandidates:   200,
 		EventStaleThreshold:  time.Duration(7*24) * time.Hour,
 		EventCleanupInterval: time.Duration(24) * time.Hour,
+		ReportCacheTtl:       time.Duration(15) * time.Minute,
+		ReportCacheSize:      256,
 		LogFile:              "amt.log",
 		LogLevel:             logrus.PanicLevel,
 		PollEvents:           true,
@@ -41,8 +103,9 @@ func defaultConfig() Config {
 	}
 }
 
+// loadConfigFile decodes onto the defaults, so keys missing from an older config file keep their default
 func loadConfigFile(path string) (Config, error) {
-	var config Config
+	config := defaultConfig()
 	if _, err := toml.DecodeFile(path, &config); err != nil {
 		return Config{}, err
 	}
@@ -66,6 +129,7 @@ func saveConfigFile(path string, config Config) error {
 func getConfig() (Config, error) {
 	var configPath string
 	flag.StringVar(&configPath, "config", "amt.toml", "path to config file")
+	flag.BoolVar(&refreshItems, "refresh-items", false, "refresh item metadata from item_data_url and exit")
 	flag.Parse()
 
 	var config Config
@@ -87,3 +151,16 @@ func getConfig() (Config, error) {
 	}
 	return config, nil
 }
+
+func validateConfig() error {
+	if err := validateEstimator(config.PriceEstimator); err != nil {
+		return err
+	}
+	if err := validateValuation(defaultValuation()); err != nil {
+		return err
+	}
+	if _, err := normalizeLanguage(config.DefaultLanguage); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+)
+
+const (
+	CounterKindWeapon = "weapon"
+	CounterKindBuild  = "build"
+)
+
+// CounterStats are the fights of an opponent with the item, from the side the report is written for
+type CounterStats struct {
+	Wins         int64
+	Losses       int64
+	SilverGained float64
+	SilverLost   float64
+}
+
+type CounterKey struct {
+	Kind string
+	Keys BuildSlotKeys
+}
+
+func (stats CounterStats) record(won bool, count int64, silver float64) CounterStats {
+	if won {
+		stats.Wins += count
+		stats.SilverGained += silver
+	} else {
+		stats.Losses += count
+		stats.SilverLost += silver
+	}
+	return stats
+}
+
+// generateCounterReport lists the weapons and builds that fought builds with the item as main hand.
+// The counters report is written from the opponents' side, so the best counters have the highest win
+// rate. With weakTo it is written from the item's side, and the opponents weakest to it come first.
+// Silver is the average worth of the gear of the stored build that died.
+func generateCounterReport(item Item, weakTo bool, valuation Valuation, language string, spec BuildKeySpec, minUsages int, out RowWriter) error {
+	buildsToStats, err := getStoredBuildStats(valuation)
+	if err != nil {
+		return err
+	}
+
+	builds := make(map[string]Build)
+	parse := func(key string) (Build, bool) {
+		build, found := builds[key]
+		if !found {
+			parsed, err := parseBuildKey(key)
+			if err != nil {
+				log.Error("Failed to parse build key: ", err)
+				return build, false
+			}
+			builds[key], build = parsed, parsed
+		}
+		return build, true
+	}
+
+	type fight struct {
+		opponent Build
+		won      bool
+		count    int64
+		silver   float64
+	}
+	var fights []fight
+	err = forEachBuildMatchup(func(killerKey string, victimKey string, count int64) error {
+		killer, killerParsed := parse(killerKey)
+		victim, victimParsed := parse(victimKey)
+		if !killerParsed || !victimParsed {
+			return nil
+		}
+		silver := buildsToStats[victimKey].averageValue() * float64(count)
+		if itemMatches(item, victim.MainHand) {
+			fights = append(fights, fight{opponent: killer, won: !weakTo, count: count, silver: silver})
+		}
+		if itemMatches(item, killer.MainHand) {
+			fights = append(fights, fight{opponent: victim, won: weakTo, count: count, silver: silver})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to read build matchups: ", err)
+		return err
+	}
+
+	countersToStats := make(map[CounterKey]CounterStats)
+	for _, fight := range fights {
+		weapon := CounterKey{Kind: CounterKindWeapon, Keys: BuildSlotKeys{spec.slotKey(fight.opponent.MainHand, false)}}
+		build := CounterKey{Kind: CounterKindBuild, Keys: spec.buildKeys(fight.opponent)}
+		for _, key := range []CounterKey{weapon, build} {
+			countersToStats[key] = countersToStats[key].record(fight.won, fight.count, fight.silver)
+		}
+	}
+
+	// get human readable
+	var opponents []BuildSlotKeys
+	for key := range countersToStats {
+		opponents = append(opponents, key.Keys)
+	}
+	names := buildKeyNames(opponents, language)
+
+	header := append([]string{"kind"}, buildSlotColumns...)
+	header = append(header, "usages", "win_rate", "silver_ratio", "wins", "losses", "silver_gained", "silver_lost")
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for key, stats := range countersToStats {
+		usages := stats.Wins + stats.Losses
+		if usages < int64(minUsages) {
+			continue
+		}
+		row := append([]string{key.Kind}, spec.buildLabels(key.Keys, names)...)
+		row = append(row,
+			fmt.Sprintf("%d", usages),
+			fmt.Sprintf("%f", float64(stats.Wins)/math.Max(float64(usages), 1.0)),
+			fmt.Sprintf("%f", stats.SilverGained/math.Max(stats.SilverLost, 1.0)),
+			fmt.Sprintf("%d", stats.Wins),
+			fmt.Sprintf("%d", stats.Losses),
+			fmt.Sprintf("%f", stats.SilverGained),
+			fmt.Sprintf("%f", stats.SilverLost),
+		)
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveCounterReport reads the options shared by the counters and weakTo reports
+func serveCounterReport(w http.ResponseWriter, r *http.Request, name string, weakTo bool) {
+	query := r.URL.Query()
+	item, err := typeStringToItem(query.Get("item"), 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if item.Name == "" {
+		http.Error(w, "Missing item", http.StatusBadRequest)
+		return
+	}
+	valuation, err := valuationFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := formatFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// best matchups first unless asked otherwise
+	if !query.Has("sort") {
+		query.Set("sort", "win_rate")
+	}
+	page, err := pageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spec, err := buildKeySpecFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minUsages, err := intFromQuery(query, "minUsages", defaultMinPairUsages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := struct {
+		Item      Item
+		Valuation Valuation
+		Language  string
+		Spec      BuildKeySpec
+		MinUsages int
+	}{item, valuation, language, spec, minUsages}
+	serveReport(w, r, name, reportCacheKey(name, options), format, page, func(out RowWriter) error {
+		return generateCounterReport(item, weakTo, valuation, language, spec, minUsages, out)
+	})
+}
+
+func countersHandler(w http.ResponseWriter, r *http.Request) {
+	serveCounterReport(w, r, "counters", false)
+}
+
+func weakToHandler(w http.ResponseWriter, r *http.Request) {
+	serveCounterReport(w, r, "weakTo", true)
+}
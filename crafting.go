@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Ingredient struct {
+	Item       Item
+	Count      int64
+	Returnable bool
+}
+
+type Recipe struct {
+	Item        Item
+	Ingredients []Ingredient
+	Amount      int64
+}
+
+type CraftingBonus struct {
+	Focus     bool
+	CityBonus bool
+}
+
+// getRecipes returns the crafting recipes stored with the item metadata
+func getRecipes() (map[Item]Recipe, error) {
+	metas, err := getItemMeta()
+	if err != nil {
+		return nil, err
+	}
+	recipes := make(map[Item]Recipe)
+	for item, meta := range metas {
+		if meta.Recipe != nil {
+			recipes[item] = *meta.Recipe
+		}
+	}
+	return recipes, nil
+}
+
+func returnRate(bonus CraftingBonus) float64 {
+	production := config.CraftingBaseBonus
+	if bonus.Focus {
+		production += config.CraftingFocusBonus
+	}
+	if bonus.CityBonus {
+		production += config.CraftingCityBonus
+	}
+	return 1.0 - 1.0/(1.0+production)
+}
+
+// craftingCost is the material cost of crafting one item after resource returns,
+// zero if any ingredient has no price
+func craftingCost(recipe Recipe, ingredientPrices map[Item]float64, bonus CraftingBonus) float64 {
+	rate := returnRate(bonus)
+	cost := 0.0
+	for _, ingredient := range recipe.Ingredients {
+		price := ingredientPrices[ingredient.Item]
+		if price == 0.0 {
+			return 0.0
+		}
+		count := float64(ingredient.Count)
+		if ingredient.Returnable {
+			count *= 1.0 - rate
+		}
+		cost += price * count
+	}
+	return cost / float64(recipe.Amount)
+}
+
+func getIngredients(recipeList []Recipe) []Item {
+	ingredientSet := make(map[Item]bool)
+	var ingredients []Item
+	for _, recipe := range recipeList {
+		for _, ingredient := range recipe.Ingredients {
+			if !ingredientSet[ingredient.Item] {
+				ingredientSet[ingredient.Item] = true
+				ingredients = append(ingredients, ingredient.Item)
+			}
+		}
+	}
+	return ingredients
+}
+
+// estimateCraftingCosts is the last step of the valuation fallback chain
+func estimateCraftingCosts(missing []Item, itemPrices map[Item]float64, estimated map[Item]string, valuation Valuation) {
+	allRecipes, err := getRecipes()
+	if err != nil {
+		log.Error("Failed to load recipes for crafting cost estimates: ", err)
+		return
+	}
+
+	var recipeList []Recipe
+	recipeItems := make(map[Item]Recipe)
+	for _, item := range missing {
+		if itemPrices[item] != 0.0 {
+			continue
+		}
+		recipeItem := tradableEquivalent(item)
+		recipeItem.Quality = 0
+		if recipe, found := allRecipes[recipeItem]; found {
+			recipeList = append(recipeList, recipe)
+			recipeItems[item] = recipe
+		}
+	}
+	if len(recipeList) == 0 {
+		return
+	}
+
+	ingredientPrices, err := getItemPrices(getIngredients(recipeList), valuation)
+	if err != nil {
+		log.Debug("Failed to get some ingredient prices: ", err)
+	}
+	for item, recipe := range recipeItems {
+		if cost := craftingCost(recipe, ingredientPrices, CraftingBonus{}); cost != 0.0 {
+			itemPrices[item] = cost
+			estimated[item] = ValueCraftingCost
+		}
+	}
+}
+
+// getItemUsages counts how often each exact item was worn in solo fights. It reads the daily build
+// aggregates rather than the events, they keep every slot of the builds with exact tiers.
+func getItemUsages(filter BuildFilter) (map[Item]int64, error) {
+	usages := make(map[Item]int64)
+	buildAggregates, err := queryBuildAggregates()
+	if err != nil {
+		log.Error("Failed to query build aggregates: ", err)
+		return usages, err
+	}
+	for key, aggregate := range buildAggregates {
+		build, err := parseBuildKey(key)
+		if err != nil {
+			log.Error("Failed to parse build key: ", err)
+			continue
+		}
+		for _, item := range getItemsFromBuilds([]Build{build}, filter) {
+			item.Quality = 0
+			usages[item] += aggregate.Kills + aggregate.Deaths
+		}
+	}
+	return usages, nil
+}
+
+type CraftProfit struct {
+	Item         Item
+	Usages       int64
+	MaterialCost float64
+	MarketPrice  float64
+	Profit       float64
+	Margin       float64
+}
+
+func generateCraftProfitReport(valuation Valuation, bonus CraftingBonus, rank string, limit int, language string) ([][]string, error) {
+	response := [][]string{}
+
+	allRecipes, err := getRecipes()
+	if err != nil {
+		log.Error("Failed to load recipes: ", err)
+		return response, err
+	}
+
+	var buildFilter = BuildFilter{
+		MainHand: true,
+		OffHand:  true,
+		Head:     true,
+		Chest:    true,
+		Foot:     true,
+		Cape:     true,
+		Potion:   true,
+		Food:     true,
+		Mount:    false,
+		Bag:      false,
+	}
+	usages, err := getItemUsages(buildFilter)
+	if err != nil {
+		log.Error("Failed to count item usages: ", err)
+		return response, err
+	}
+
+	// only price what the meta actually uses, most used first
+	var craftable []Item
+	for item := range usages {
+		if _, found := allRecipes[item]; found && !isNonTradable(item) {
+			craftable = append(craftable, item)
+		}
+	}
+	// ties by type string, so the same items make the limit every time
+	sort.SliceStable(craftable, func(a, b int) bool {
+		if usages[craftable[a]] != usages[craftable[b]] {
+			return usages[craftable[a]] > usages[craftable[b]]
+		}
+		return itemToTypeString(craftable[a]) < itemToTypeString(craftable[b])
+	})
+	if limit > 0 && len(craftable) > limit {
+		craftable = craftable[:limit]
+	}
+
+	var recipeList []Recipe
+	for _, item := range craftable {
+		recipeList = append(recipeList, allRecipes[item])
+	}
+	ingredientPrices, _ := getItemPrices(getIngredients(recipeList), valuation)
+	marketPrices, _ := getItemPrices(craftable, valuation)
+
+	var profits []CraftProfit
+	for _, item := range craftable {
+		cost := craftingCost(allRecipes[item], ingredientPrices, bonus)
+		price := marketPrices[item]
+		if cost == 0.0 || price == 0.0 {
+			continue
+		}
+		profits = append(profits, CraftProfit{
+			Item:         item,
+			Usages:       usages[item],
+			MaterialCost: cost,
+			MarketPrice:  price,
+			Profit:       price - cost,
+			Margin:       (price - cost) / price,
+		})
+	}
+
+	sort.SliceStable(profits, func(a, b int) bool {
+		switch rank {
+		case "demand":
+			return profits[a].Usages > profits[b].Usages
+		case "profit":
+			return profits[a].Profit > profits[b].Profit
+		}
+		return profits[a].Margin > profits[b].Margin
+	})
+
+	var items []Item
+	for _, profit := range profits {
+		items = append(items, profit.Item)
+	}
+	humanReadableNamesBatch, err := manyToHumanReadable(items, language)
+	if err != nil {
+		log.Error("Failed to fetch some human readable names during report generation: ", err)
+	}
+
+	response = append(response, []string{
+		"item_id",
+		"type",
+		"usages",
+		"material_cost",
+		"market_price",
+		"profit",
+		"margin",
+	})
+	for _, profit := range profits {
+		response = append(response, []string{
+			humanReadableNamesBatch[profit.Item.Name],
+			itemToTypeString(profit.Item),
+			fmt.Sprintf("%d", profit.Usages),
+			fmt.Sprintf("%f", profit.MaterialCost),
+			fmt.Sprintf("%f", profit.MarketPrice),
+			fmt.Sprintf("%f", profit.Profit),
+			fmt.Sprintf("%f", profit.Margin),
+		})
+	}
+
+	return response, nil
+}
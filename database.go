@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -32,11 +33,18 @@ func databaseCleanup() {
 		}
 		log.Debug("Deleted ", rowsAffected, " old records")
 
+		// aggregates are kept by day, so a day is only dropped once all of it is stale
+		for _, table := range aggregateTables {
+			if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE day < ?", table), eventDay(threshold)); err != nil {
+				log.Error("Failed to clean up aggregate table ", table, ": ", err)
+			}
+		}
+
 		db.Close()
 	}
 }
 
-func updatePrices(itemPrices map[Item]float64) error {
+func updatePrices(itemPrices map[Item]LocationPrices) error {
 	db, err := sql.Open("sqlite3", config.Database)
 	if err != nil {
 		log.Error("Failed to open database: ", err)
@@ -59,16 +67,21 @@ func updatePrices(itemPrices map[Item]float64) error {
 			err = tx.Commit()
 			if err != nil {
 				log.Println("Error committing transaction:", err)
+			} else if len(itemPrices) != 0 {
+				invalidateReports()
 			}
 		}
 	}()
 
 	// Prepare the insert or update statement
 	stmt, err := tx.Prepare(`INSERT INTO prices (
-			name, tier, enchantment, quality, price, timestamp
-		) VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(name, tier, enchantment, quality) DO UPDATE SET 
+			name, tier, enchantment, quality, location, price, method, samples, source, timestamp
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name, tier, enchantment, quality, location) DO UPDATE SET 
 			price = excluded.price,
+			method = excluded.method,
+			samples = excluded.samples,
+			source = excluded.source,
 			timestamp = excluded.timestamp`)
 	if err != nil {
 		return err
@@ -76,10 +89,12 @@ func updatePrices(itemPrices map[Item]float64) error {
 	defer stmt.Close()
 
 	// Iterate through items and execute the statement
-	for item, price := range itemPrices {
-		_, err = stmt.Exec(item.Name, item.Tier, item.Enchantment, item.Quality, price, time.Now())
-		if err != nil {
-			return err
+	for item, locationPrices := range itemPrices {
+		for location, estimate := range locationPrices {
+			_, err = stmt.Exec(item.Name, item.Tier, item.Enchantment, item.Quality, location, estimate.Price, estimate.Method, estimate.Samples, estimate.Source, time.Now())
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -102,8 +117,8 @@ func splitArray(arr []Item, maxSize int) [][]Item {
 	return result
 }
 
-func queryPrices(items []Item) (map[Item]float64, error) {
-	itemPrices := make(map[Item]float64)
+func queryPrices(items []Item) (map[Item]LocationPrices, error) {
+	itemPrices := make(map[Item]LocationPrices)
 	var errs []error
 
 	itemBatches := splitArray(items, 249)
@@ -113,8 +128,8 @@ func queryPrices(items []Item) (map[Item]float64, error) {
 		if err != nil {
 			log.Error("Failed to query price batch: ", itemBatchPrices)
 		}
-		for batchItem, batchPrice := range itemBatchPrices {
-			itemPrices[batchItem] = batchPrice
+		for batchItem, batchPrices := range itemBatchPrices {
+			itemPrices[batchItem] = batchPrices
 		}
 	}
 
@@ -124,8 +139,8 @@ func queryPrices(items []Item) (map[Item]float64, error) {
 	return itemPrices, nil
 }
 
-func queryPricesBatch(items []Item) (map[Item]float64, error) {
-	itemPrices := make(map[Item]float64)
+func queryPricesBatch(items []Item) (map[Item]LocationPrices, error) {
+	itemPrices := make(map[Item]LocationPrices)
 
 	db, err := sql.Open("sqlite3", config.Database)
 	if err != nil {
@@ -141,7 +156,7 @@ func queryPricesBatch(items []Item) (map[Item]float64, error) {
 		placeholders = append(placeholders, "(?, ?, ?, ?)")
 		params = append(params, item.Name, item.Tier, item.Enchantment, item.Quality)
 	}
-	query := fmt.Sprintf(`SELECT name, tier, enchantment, quality, price, timestamp FROM prices WHERE (name, tier, enchantment, quality) IN (%s)`, strings.Join(placeholders, ","))
+	query := fmt.Sprintf(`SELECT name, tier, enchantment, quality, location, price, method, samples, source, timestamp FROM prices WHERE (name, tier, enchantment, quality) IN (%s)`, strings.Join(placeholders, ","))
 
 	// Execute the query
 	rows, err := db.Query(query, params...)
@@ -154,18 +169,21 @@ func queryPricesBatch(items []Item) (map[Item]float64, error) {
 	// Iterate through the result set
 	for rows.Next() {
 		var item Item
-		var price float64
+		var location string
+		var estimate PriceEstimate
 		var timestamp time.Time
-		if err := rows.Scan(&item.Name, &item.Tier, &item.Enchantment, &item.Quality, &price, &timestamp); err != nil {
+		if err := rows.Scan(&item.Name, &item.Tier, &item.Enchantment, &item.Quality, &location, &estimate.Price, &estimate.Method, &estimate.Samples, &estimate.Source, &timestamp); err != nil {
 			log.Error("Failed to scan record into item struct: ", err)
 			return itemPrices, err
 		}
-		// Store the price in the map with the item as the key
+		// Skip stale prices so they get fetched again
 		if time.Since(timestamp) > config.PriceStaleThreshold {
-			itemPrices[item] = 0.0
-		} else {
-			itemPrices[item] = price
+			continue
 		}
+		if itemPrices[item] == nil {
+			itemPrices[item] = make(LocationPrices)
+		}
+		itemPrices[item][location] = estimate
 	}
 	if err := rows.Err(); err != nil {
 		log.Error("Row error encountered while querying item prices: ", err)
@@ -175,6 +193,57 @@ func queryPricesBatch(items []Item) (map[Item]float64, error) {
 	return itemPrices, nil
 }
 
+// queryPricesByName returns the fresh prices stored for every tier, enchantment and quality of the named items
+func queryPricesByName(names []string) (map[Item]LocationPrices, error) {
+	itemPrices := make(map[Item]LocationPrices)
+	if len(names) == 0 {
+		return itemPrices, nil
+	}
+
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return itemPrices, err
+	}
+	defer db.Close()
+
+	var placeholders []string
+	var params []interface{}
+	for _, name := range names {
+		placeholders = append(placeholders, "?")
+		params = append(params, name)
+	}
+	params = append(params, time.Now().Add(-config.PriceStaleThreshold))
+	query := fmt.Sprintf(`SELECT name, tier, enchantment, quality, location, price, method, samples, source FROM prices WHERE name IN (%s) AND timestamp >= ?`, strings.Join(placeholders, ","))
+
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		log.Error("Failed to execute query for item prices by name: ", err)
+		return itemPrices, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		var location string
+		var estimate PriceEstimate
+		if err := rows.Scan(&item.Name, &item.Tier, &item.Enchantment, &item.Quality, &location, &estimate.Price, &estimate.Method, &estimate.Samples, &estimate.Source); err != nil {
+			log.Error("Failed to scan record into item struct: ", err)
+			return itemPrices, err
+		}
+		if itemPrices[item] == nil {
+			itemPrices[item] = make(LocationPrices)
+		}
+		itemPrices[item][location] = estimate
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying item prices by name: ", err)
+		return itemPrices, err
+	}
+
+	return itemPrices, nil
+}
+
 func insertEvents(events []Event) error {
 	db, err := sql.Open("sqlite3", config.Database)
 	if err != nil {
@@ -183,6 +252,10 @@ func insertEvents(events []Event) error {
 	}
 	defer db.Close()
 
+	// item power can need item metadata from the database, so it is worked out before the
+	// transaction takes the write lock
+	powers := eventPowers(events)
+
 	// Begin a transaction
 	tx, err := db.Begin()
 	if err != nil {
@@ -221,15 +294,25 @@ func insertEvents(events []Event) error {
 		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 
 		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
+		tx.Rollback()
 		log.Error("Failed to prepare sql statement: ", err)
 		return err
 	}
 	defer stmt.Close()
 
+	aggregates, err := prepareAggregateStatements(tx)
+	if err != nil {
+		tx.Rollback()
+		log.Error("Failed to prepare aggregate statements: ", err)
+		return err
+	}
+	defer aggregates.Close()
+
 	// Execute batch insert within the transaction
-	for _, event := range events {
+	inserted := int64(0)
+	for i, event := range events {
 		log.Debug("Inserting event: ", event.EventId)
-		_, err = stmt.Exec(
+		result, err := stmt.Exec(
 			event.EventId,
 			event.KillerBuild.MainHand.Name, event.KillerBuild.MainHand.Tier, event.KillerBuild.MainHand.Enchantment, event.KillerBuild.MainHand.Quality,
 			event.KillerBuild.OffHand.Name, event.KillerBuild.OffHand.Tier, event.KillerBuild.OffHand.Enchantment, event.KillerBuild.OffHand.Quality,
@@ -261,6 +344,18 @@ func insertEvents(events []Event) error {
 			log.Error("Failed insert for event: ", event, err)
 			return err
 		}
+
+		// events already stored are ignored above and must not be counted twice
+		rowsAffected, err := result.RowsAffected()
+		if err == nil && rowsAffected == 1 && event.NumberOfParticipants == 1 {
+			err = aggregates.addEvent(event, powers[i])
+		}
+		inserted += rowsAffected
+		if err != nil {
+			tx.Rollback()
+			log.Error("Failed to aggregate event: ", event.EventId, err)
+			return err
+		}
 	}
 
 	// Commit the transaction
@@ -270,6 +365,9 @@ func insertEvents(events []Event) error {
 		log.Error("Failed to commit: ", err)
 		return err
 	}
+	if inserted != 0 {
+		invalidateReports()
+	}
 
 	return nil
 }
@@ -318,29 +416,216 @@ func initDatabase() error {
 			tier INTEGER,
 			enchantment INTEGER,
 			quality INTEGER,
+			location TEXT NOT NULL DEFAULT '',
 			price REAL,
+			method TEXT NOT NULL DEFAULT '',
+			samples INTEGER NOT NULL DEFAULT 0,
+			source TEXT NOT NULL DEFAULT 'history',
 			timestamp DATETIME
 		);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_prices_unique ON prices (name, tier, enchantment, quality);
+		CREATE TABLE IF NOT EXISTS price_refresh_attempts (
+			name TEXT NOT NULL,
+			tier INTEGER NOT NULL,
+			enchantment INTEGER NOT NULL,
+			quality INTEGER NOT NULL,
+			attempted DATETIME,
+			PRIMARY KEY (name, tier, enchantment, quality)
+		);
+		CREATE TABLE IF NOT EXISTS items_meta (
+			name TEXT NOT NULL,
+			tier INTEGER NOT NULL,
+			enchantment INTEGER NOT NULL,
+			category TEXT NOT NULL DEFAULT '',
+			subcategory TEXT NOT NULL DEFAULT '',
+			slot_type TEXT NOT NULL DEFAULT '',
+			item_power REAL NOT NULL DEFAULT 0,
+			two_handed INTEGER NOT NULL DEFAULT 0,
+			artifact INTEGER NOT NULL DEFAULT 0,
+			crafting_requirements TEXT NOT NULL DEFAULT '',
+			updated DATETIME
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_items_meta_unique ON items_meta (name, tier, enchantment);
+		CREATE TABLE IF NOT EXISTS item_names (
+			name TEXT NOT NULL,
+			language TEXT NOT NULL,
+			display_name TEXT NOT NULL,
+			updated DATETIME
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_item_names_unique ON item_names (name, language);
+		CREATE TABLE IF NOT EXISTS item_name_sources (
+			url TEXT PRIMARY KEY,
+			etag TEXT NOT NULL DEFAULT '',
+			updated DATETIME
+		);
+		CREATE TABLE IF NOT EXISTS item_daily_stats (
+			name TEXT NOT NULL,
+			equivalence INTEGER NOT NULL,
+			day TEXT NOT NULL,
+			slot TEXT NOT NULL,
+			kills INTEGER NOT NULL DEFAULT 0,
+			deaths INTEGER NOT NULL DEFAULT 0,
+			sum_average_ip REAL NOT NULL DEFAULT 0,
+			sum_item_ip REAL NOT NULL DEFAULT 0,
+			sum_gear_ip REAL NOT NULL DEFAULT 0,
+			sum_mastery REAL NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_item_daily_stats_unique ON item_daily_stats (name, equivalence, day, slot);
+		CREATE TABLE IF NOT EXISTS item_daily_values (
+			name TEXT NOT NULL,
+			equivalence INTEGER NOT NULL,
+			day TEXT NOT NULL,
+			outcome TEXT NOT NULL,
+			value_name TEXT NOT NULL,
+			value_tier INTEGER NOT NULL,
+			value_enchantment INTEGER NOT NULL,
+			value_quality INTEGER NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_item_daily_values_unique ON item_daily_values (name, equivalence, day, outcome, value_name, value_tier, value_enchantment, value_quality);
+		CREATE TABLE IF NOT EXISTS item_daily_matchups (
+			name TEXT NOT NULL,
+			equivalence INTEGER NOT NULL,
+			day TEXT NOT NULL,
+			ip_basis TEXT NOT NULL,
+			ip_difference REAL NOT NULL,
+			won INTEGER NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_item_daily_matchups_unique ON item_daily_matchups (name, equivalence, day, ip_basis, ip_difference, won);
+		CREATE TABLE IF NOT EXISTS daily_ip_differences (
+			day TEXT NOT NULL,
+			ip_basis TEXT NOT NULL,
+			ip_difference REAL NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_daily_ip_differences_unique ON daily_ip_differences (day, ip_basis, ip_difference);
+		CREATE TABLE IF NOT EXISTS build_daily_stats (
+			build_key TEXT NOT NULL,
+			day TEXT NOT NULL,
+			kills INTEGER NOT NULL DEFAULT 0,
+			deaths INTEGER NOT NULL DEFAULT 0,
+			sum_average_ip REAL NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_build_daily_stats_unique ON build_daily_stats (build_key, day);
+		CREATE TABLE IF NOT EXISTS build_daily_values (
+			build_key TEXT NOT NULL,
+			day TEXT NOT NULL,
+			outcome TEXT NOT NULL,
+			value_name TEXT NOT NULL,
+			value_tier INTEGER NOT NULL,
+			value_enchantment INTEGER NOT NULL,
+			value_quality INTEGER NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_build_daily_values_unique ON build_daily_values (build_key, day, outcome, value_name, value_tier, value_enchantment, value_quality);
+		CREATE TABLE IF NOT EXISTS build_daily_matchups (
+			killer_build_key TEXT NOT NULL,
+			victim_build_key TEXT NOT NULL,
+			day TEXT NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_build_daily_matchups_unique ON build_daily_matchups (killer_build_key, victim_build_key, day);
 	`
+	if err := dropNameOnlyBuilds(db); err != nil {
+		log.Error("Failed to migrate database: ", err)
+		return err
+	}
 	if _, err := db.Exec(createTables); err != nil {
 		log.Error("Failed to create tables: ", err)
 		return err
 	}
+	if err := migrateDatabase(db); err != nil {
+		log.Error("Failed to migrate database: ", err)
+		return err
+	}
 	return nil
 }
 
-func queryAllEvents() ([]Event, error) {
-	// Connect to the SQLite database
-	var err error
-	var events []Event
-	db, err := sql.Open("sqlite3", config.Database)
+func hasColumn(db *sql.DB, table string, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		log.Error("Failed to open database: ", err)
-		return events, err
+		return false, err
 	}
-	defer db.Close()
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid int
+		var name, columnType string
+		var notNull, primaryKey int
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) error {
+	present, err := hasColumn(db, table, column)
+	if err != nil || present {
+		return err
+	}
+	log.Info("Adding column ", column, " to table ", table)
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// dropNameOnlyBuilds drops build aggregates keyed by item names only, which can't be split back into
+// tiers. It runs before the tables are created, and the builds are rebuilt from the stored events.
+func dropNameOnlyBuilds(db *sql.DB) error {
+	present, err := hasColumn(db, "build_daily_stats", "build")
+	if err != nil || !present {
+		return err
+	}
+	log.Info("Dropping build aggregates keyed by item names only")
+	_, err = db.Exec("DROP TABLE build_daily_stats; DROP TABLE IF EXISTS build_daily_values")
+	return err
+}
+
+func migrateDatabase(db *sql.DB) error {
+	// prices used to be pooled across all locations, those rows can't be attributed to a city
+	present, err := hasColumn(db, "prices", "location")
+	if err != nil {
+		return err
+	}
+	if !present {
+		if err := addColumnIfMissing(db, "prices", "location", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		if _, err := db.Exec("DELETE FROM prices WHERE location = ''"); err != nil {
+			return err
+		}
+	}
+
+	if err := addColumnIfMissing(db, "prices", "method", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "prices", "samples", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "prices", "source", "TEXT NOT NULL DEFAULT 'history'"); err != nil {
+		return err
+	}
+
+	migrations := `
+		DROP INDEX IF EXISTS idx_prices_unique;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_prices_location_unique ON prices (name, tier, enchantment, quality, location);
+	`
+	_, err = db.Exec(migrations)
+	return err
+}
 
+// eventQueryer is a database or a transaction events can be read from
+type eventQueryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// forEachEvent calls fn with each event matching the condition as it is read, so no caller holds every
+// stored event at once
+func forEachEvent(queryer eventQueryer, condition string, fn func(Event) error) error {
 	query := `SELECT 
 		id,
 		killer_main_hand_name, killer_main_hand_tier, killer_main_hand_enchantment, killer_main_hand_quality,
@@ -366,18 +651,18 @@ func queryAllEvents() ([]Event, error) {
 		victim_bag_name, victim_bag_tier, victim_bag_enchantment, victim_bag_quality,
 		victim_average_ip,
 		number_of_participants, timestamp
-	FROM events`
+	FROM events ` + condition
 
-	rows, err := db.Query(query)
+	rows, err := queryer.Query(query)
 	if err != nil {
-		log.Error("Query for all events failed: ", err)
-		return events, err
+		log.Error("Query for events failed: ", err)
+		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var event Event
-		err := rows.Scan(
+		if err := rows.Scan(
 			&event.EventId,
 			&event.KillerBuild.MainHand.Name, &event.KillerBuild.MainHand.Tier, &event.KillerBuild.MainHand.Enchantment, &event.KillerBuild.MainHand.Quality,
 			&event.KillerBuild.OffHand.Name, &event.KillerBuild.OffHand.Tier, &event.KillerBuild.OffHand.Enchantment, &event.KillerBuild.OffHand.Quality,
@@ -402,19 +687,17 @@ func queryAllEvents() ([]Event, error) {
 			&event.VictimBuild.Bag.Name, &event.VictimBuild.Bag.Tier, &event.VictimBuild.Bag.Enchantment, &event.VictimBuild.Bag.Quality,
 			&event.VictimAverageIp,
 			&event.NumberOfParticipants, &event.Timestamp,
-		)
-		if err != nil {
-			return nil, err
+		); err != nil {
+			log.Error("Failed to scan event: ", err)
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
 		}
-		events = append(events, event)
 	}
 
 	// Check for any errors encountered during iteration
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return events, nil
+	return rows.Err()
 }
 
 func getNumEvents() (int, error) {
@@ -460,3 +743,857 @@ func getNumPrices() (int, error) {
 
 	return count, nil
 }
+
+var eventItemSlots = []string{"main_hand", "off_hand", "head", "chest", "foot", "cape", "potion", "food", "mount", "bag"}
+
+func slotHasQuality(slot string) bool {
+	return slot != "potion" && slot != "food"
+}
+
+// queryRefreshCandidates returns the items referenced most by stored events whose freshest price
+// was fetched before the given time, most referenced first. Items a refresh got no price for are left
+// out until attemptedBefore, so items without a market don't take the budget every cycle.
+func queryRefreshCandidates(updatedBefore time.Time, attemptedBefore time.Time, limit int) ([]Item, error) {
+	var items []Item
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return items, err
+	}
+	defer db.Close()
+
+	var selects []string
+	for _, side := range []string{"killer", "victim"} {
+		for _, slot := range eventItemSlots {
+			quality := "0"
+			if slotHasQuality(slot) {
+				quality = fmt.Sprintf("%s_%s_quality", side, slot)
+			}
+			selects = append(selects, fmt.Sprintf(
+				"SELECT %[1]s_%[2]s_name AS name, %[1]s_%[2]s_tier AS tier, %[1]s_%[2]s_enchantment AS enchantment, %[3]s AS quality FROM events",
+				side, slot, quality))
+		}
+	}
+	query := fmt.Sprintf(`SELECT refs.name, refs.tier, refs.enchantment, refs.quality
+		FROM (%s) AS refs
+		LEFT JOIN (
+			SELECT name, tier, enchantment, quality, MAX(timestamp) AS updated
+			FROM prices GROUP BY name, tier, enchantment, quality
+		) AS updates
+		ON refs.name = updates.name AND refs.tier = updates.tier AND refs.enchantment = updates.enchantment AND refs.quality = updates.quality
+		LEFT JOIN price_refresh_attempts AS attempts
+		ON refs.name = attempts.name AND refs.tier = attempts.tier AND refs.enchantment = attempts.enchantment AND refs.quality = attempts.quality
+		WHERE refs.name != '' AND refs.name NOT LIKE '%%_NONTRADABLE'
+			AND (updates.updated IS NULL OR updates.updated < ?)
+			AND (attempts.attempted IS NULL OR attempts.attempted < ?)
+		GROUP BY refs.name, refs.tier, refs.enchantment, refs.quality
+		ORDER BY COUNT(*) DESC
+		LIMIT ?`, strings.Join(selects, " UNION ALL "))
+
+	rows, err := db.Query(query, updatedBefore, attemptedBefore, limit)
+	if err != nil {
+		log.Error("Failed to query price refresh candidates: ", err)
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.Name, &item.Tier, &item.Enchantment, &item.Quality); err != nil {
+			log.Error("Failed to scan price refresh candidate: ", err)
+			return items, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying price refresh candidates: ", err)
+		return items, err
+	}
+
+	return items, nil
+}
+
+// recordRefreshAttempts remembers when a refresh last asked for the items without getting a price
+func recordRefreshAttempts(items []Item, attempted time.Time) (err error) {
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	stmt, err := tx.Prepare(`INSERT INTO price_refresh_attempts (name, tier, enchantment, quality, attempted)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name, tier, enchantment, quality) DO UPDATE SET attempted = excluded.attempted`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range items {
+		if _, err = stmt.Exec(item.Name, item.Tier, item.Enchantment, item.Quality, attempted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceItemMeta replaces all stored item metadata in one transaction, so readers never see a partial dump
+func replaceItemMeta(metas []ItemMeta) (err error) {
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			log.Println("Transaction rolled back due to error:", err)
+		} else {
+			err = tx.Commit()
+			if err != nil {
+				log.Println("Error committing transaction:", err)
+			}
+		}
+	}()
+
+	if _, err = tx.Exec("DELETE FROM items_meta"); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO items_meta (
+			name, tier, enchantment, category, subcategory, slot_type, item_power, two_handed, artifact, crafting_requirements, updated
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	updated := time.Now()
+	for _, meta := range metas {
+		requirements := ""
+		if meta.Recipe != nil {
+			var encoded []byte
+			encoded, err = json.Marshal(meta.Recipe)
+			if err != nil {
+				return err
+			}
+			requirements = string(encoded)
+		}
+		_, err = stmt.Exec(meta.Item.Name, meta.Item.Tier, meta.Item.Enchantment, meta.Category, meta.Subcategory, meta.SlotType,
+			meta.ItemPower, meta.TwoHanded, meta.Artifact, requirements, updated)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func queryItemMeta() ([]ItemMeta, error) {
+	var metas []ItemMeta
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return metas, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, tier, enchantment, category, subcategory, slot_type, item_power, two_handed, artifact, crafting_requirements
+		FROM items_meta`)
+	if err != nil {
+		log.Error("Failed to query item metadata: ", err)
+		return metas, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var meta ItemMeta
+		var requirements string
+		if err := rows.Scan(&meta.Item.Name, &meta.Item.Tier, &meta.Item.Enchantment, &meta.Category, &meta.Subcategory, &meta.SlotType,
+			&meta.ItemPower, &meta.TwoHanded, &meta.Artifact, &requirements); err != nil {
+			log.Error("Failed to scan item metadata: ", err)
+			return metas, err
+		}
+		if requirements != "" {
+			var recipe Recipe
+			if err := json.Unmarshal([]byte(requirements), &recipe); err != nil {
+				log.Error("Failed to decode crafting requirements for ", meta.Item.Name, ": ", err)
+			} else {
+				meta.Recipe = &recipe
+			}
+		}
+		metas = append(metas, meta)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying item metadata: ", err)
+		return metas, err
+	}
+
+	return metas, nil
+}
+
+// getItemMetaUpdated returns when the item metadata was last refreshed, the zero time if never
+func getItemMetaUpdated() (time.Time, error) {
+	var updated time.Time
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return time.Time{}, err
+	}
+	defer db.Close()
+
+	// selecting the column keeps its declared type, so the driver parses it as a time
+	err = db.QueryRow("SELECT updated FROM items_meta ORDER BY updated DESC LIMIT 1").Scan(&updated)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		log.Error("Error while getting item metadata update time: ", err)
+		return time.Time{}, err
+	}
+	return updated, nil
+}
+
+// storeItemNames upserts display names, given per language and then per item name
+func storeItemNames(names map[string]map[string]string) (err error) {
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			log.Println("Transaction rolled back due to error:", err)
+		} else {
+			err = tx.Commit()
+			if err != nil {
+				log.Println("Error committing transaction:", err)
+			}
+		}
+	}()
+
+	stmt, err := tx.Prepare(`INSERT INTO item_names (name, language, display_name, updated) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name, language) DO UPDATE SET
+			display_name = excluded.display_name,
+			updated = excluded.updated`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	updated := time.Now()
+	for language, languageNames := range names {
+		for name, displayName := range languageNames {
+			_, err = stmt.Exec(name, language, displayName, updated)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func queryItemNames() (map[string]map[string]string, error) {
+	names := make(map[string]map[string]string)
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return names, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name, language, display_name FROM item_names")
+	if err != nil {
+		log.Error("Failed to query item names: ", err)
+		return names, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, language, displayName string
+		if err := rows.Scan(&name, &language, &displayName); err != nil {
+			log.Error("Failed to scan item name: ", err)
+			return names, err
+		}
+		if names[language] == nil {
+			names[language] = make(map[string]string)
+		}
+		names[language][name] = displayName
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying item names: ", err)
+		return names, err
+	}
+
+	return names, nil
+}
+
+// getItemNameSource returns the ETag and check time stored for a name source, empty if never fetched
+func getItemNameSource(url string) (string, time.Time, error) {
+	var etag string
+	var updated time.Time
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return etag, updated, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow("SELECT etag, updated FROM item_name_sources WHERE url = ?", url).Scan(&etag, &updated)
+	if err == sql.ErrNoRows {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		log.Error("Error while getting item name source: ", err)
+		return etag, updated, err
+	}
+	return etag, updated, nil
+}
+
+func updateItemNameSource(url string, etag string) error {
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO item_name_sources (url, etag, updated) VALUES (?, ?, ?)
+		ON CONFLICT(url) DO UPDATE SET etag = excluded.etag, updated = excluded.updated`, url, etag, time.Now())
+	if err != nil {
+		log.Error("Failed to update item name source: ", err)
+	}
+	return err
+}
+
+var aggregateTables = []string{
+	"item_daily_stats",
+	"item_daily_values",
+	"item_daily_matchups",
+	"daily_ip_differences",
+	"build_daily_stats",
+	"build_daily_values",
+	"build_daily_matchups",
+}
+
+// aggregateStatements add an event to the daily aggregate tables within the insert transaction
+type aggregateStatements struct {
+	itemStats     *sql.Stmt
+	itemValues    *sql.Stmt
+	itemMatchups  *sql.Stmt
+	ipDifferences *sql.Stmt
+	buildStats    *sql.Stmt
+	buildValues   *sql.Stmt
+	buildMatchups *sql.Stmt
+}
+
+func prepareAggregateStatements(tx *sql.Tx) (*aggregateStatements, error) {
+	statements := &aggregateStatements{}
+	queries := []struct {
+		statement **sql.Stmt
+		query     string
+	}{
+		{&statements.itemStats, `INSERT INTO item_daily_stats (
+				name, equivalence, day, slot, kills, deaths, sum_average_ip, sum_item_ip, sum_gear_ip, sum_mastery
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(name, equivalence, day, slot) DO UPDATE SET
+				kills = kills + excluded.kills,
+				deaths = deaths + excluded.deaths,
+				sum_average_ip = sum_average_ip + excluded.sum_average_ip,
+				sum_item_ip = sum_item_ip + excluded.sum_item_ip,
+				sum_gear_ip = sum_gear_ip + excluded.sum_gear_ip,
+				sum_mastery = sum_mastery + excluded.sum_mastery`},
+		{&statements.itemValues, `INSERT INTO item_daily_values (
+				name, equivalence, day, outcome, value_name, value_tier, value_enchantment, value_quality, count
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT(name, equivalence, day, outcome, value_name, value_tier, value_enchantment, value_quality) DO UPDATE SET
+				count = count + 1`},
+		{&statements.itemMatchups, `INSERT INTO item_daily_matchups (
+				name, equivalence, day, ip_basis, ip_difference, won, count
+			) VALUES (?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT(name, equivalence, day, ip_basis, ip_difference, won) DO UPDATE SET
+				count = count + 1`},
+		{&statements.ipDifferences, `INSERT INTO daily_ip_differences (
+				day, ip_basis, ip_difference, count
+			) VALUES (?, ?, ?, 1)
+			ON CONFLICT(day, ip_basis, ip_difference) DO UPDATE SET
+				count = count + 1`},
+		{&statements.buildStats, `INSERT INTO build_daily_stats (
+				build_key, day, kills, deaths, sum_average_ip
+			) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(build_key, day) DO UPDATE SET
+				kills = kills + excluded.kills,
+				deaths = deaths + excluded.deaths,
+				sum_average_ip = sum_average_ip + excluded.sum_average_ip`},
+		{&statements.buildValues, `INSERT INTO build_daily_values (
+				build_key, day, outcome, value_name, value_tier, value_enchantment, value_quality, count
+			) VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT(build_key, day, outcome, value_name, value_tier, value_enchantment, value_quality) DO UPDATE SET
+				count = count + 1`},
+		{&statements.buildMatchups, `INSERT INTO build_daily_matchups (
+				killer_build_key, victim_build_key, day, count
+			) VALUES (?, ?, ?, 1)
+			ON CONFLICT(killer_build_key, victim_build_key, day) DO UPDATE SET
+				count = count + 1`},
+	}
+	for _, query := range queries {
+		statement, err := tx.Prepare(query.query)
+		if err != nil {
+			statements.Close()
+			return nil, err
+		}
+		*query.statement = statement
+	}
+	return statements, nil
+}
+
+func (statements *aggregateStatements) Close() {
+	for _, statement := range []*sql.Stmt{
+		statements.itemStats, statements.itemValues, statements.itemMatchups,
+		statements.ipDifferences, statements.buildStats, statements.buildValues, statements.buildMatchups,
+	} {
+		if statement != nil {
+			statement.Close()
+		}
+	}
+}
+
+// addEvent counts a solo fight once from the killer's side and once from the victim's. Every item
+// is credited with the victim's gear as silver gained or lost, and with its own exact variant so
+// the worth of the gear worn can be priced later.
+func (statements *aggregateStatements) addEvent(event Event, power EventPower) error {
+	day := eventDay(event.Timestamp)
+	differences := map[string]float64{
+		IpBasisReported: event.KillerAverageIp - event.VictimAverageIp,
+		IpBasisGear:     power.KillerGearIp - power.VictimGearIp,
+	}
+	for ipBasis, difference := range differences {
+		if _, err := statements.ipDifferences.Exec(day, ipBasis, bucketIpDifference(difference)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := statements.buildMatchups.Exec(buildKey(event.KillerBuild), buildKey(event.VictimBuild), day); err != nil {
+		return err
+	}
+
+	victimItems := getItemsFromBuilds([]Build{event.VictimBuild}, reportBuildFilter)
+	sides := []struct {
+		build     Build
+		averageIp float64
+		gearIp    float64
+		won       bool
+	}{
+		{event.KillerBuild, event.KillerAverageIp, power.KillerGearIp, true},
+		{event.VictimBuild, event.VictimAverageIp, power.VictimGearIp, false},
+	}
+	for _, side := range sides {
+		kills, deaths, sign, outcome := 1, 0, 1.0, OutcomeGained
+		if !side.won {
+			kills, deaths, sign, outcome = 0, 1, -1.0, OutcomeLost
+		}
+		mastery := impliedMastery(side.gearIp, side.averageIp)
+
+		slotItems := buildSlotItems(side.build, reportBuildFilter)
+		for _, slotItem := range slotItems {
+			key := equivalentItem(slotItem.Item)
+			if _, err := statements.itemStats.Exec(key.Name, key.Tier, day, slotItem.Slot, kills, deaths, side.averageIp, power.ItemIps[slotItem.Item], side.gearIp, mastery); err != nil {
+				return err
+			}
+			for ipBasis, difference := range differences {
+				if _, err := statements.itemMatchups.Exec(key.Name, key.Tier, day, ipBasis, bucketIpDifference(sign*difference), side.won); err != nil {
+					return err
+				}
+			}
+			item := slotItem.Item
+			if _, err := statements.itemValues.Exec(key.Name, key.Tier, day, OutcomeOwn, item.Name, item.Tier, item.Enchantment, item.Quality); err != nil {
+				return err
+			}
+			for _, victimItem := range victimItems {
+				if _, err := statements.itemValues.Exec(key.Name, key.Tier, day, outcome, victimItem.Name, victimItem.Tier, victimItem.Enchantment, victimItem.Quality); err != nil {
+					return err
+				}
+			}
+		}
+
+		build := buildKey(side.build)
+		if _, err := statements.buildStats.Exec(build, day, kills, deaths, side.averageIp); err != nil {
+			return err
+		}
+		for _, slotItem := range slotItems {
+			item := slotItem.Item
+			if _, err := statements.buildValues.Exec(build, day, OutcomeOwn, item.Name, item.Tier, item.Enchantment, item.Quality); err != nil {
+				return err
+			}
+		}
+		for _, victimItem := range victimItems {
+			if _, err := statements.buildValues.Exec(build, day, outcome, victimItem.Name, victimItem.Tier, victimItem.Enchantment, victimItem.Quality); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rebuildAggregates fills the aggregate tables from the stored events when the build matchups are
+// empty, which is the case the first time a database from before them is opened. They are the newest
+// aggregate, so every older one is empty too whenever they are.
+func rebuildAggregates() (err error) {
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return err
+	}
+	defer db.Close()
+
+	var aggregated, stored int
+	if err := db.QueryRow("SELECT COUNT(*) FROM build_daily_matchups").Scan(&aggregated); err != nil {
+		log.Error("Failed to count aggregates: ", err)
+		return err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM events WHERE number_of_participants = 1").Scan(&stored); err != nil {
+		log.Error("Failed to count events: ", err)
+		return err
+	}
+	if aggregated != 0 || stored == 0 {
+		return nil
+	}
+
+	// item power is read from the cached metadata while the transaction holds the write lock, so make
+	// sure it is loaded first
+	if _, err := getItemMeta(); err != nil {
+		log.Error("Failed to load item metadata, item power will use tier defaults: ", err)
+	}
+	log.Info("Rebuilding aggregates from ", stored, " stored events")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			log.Println("Transaction rolled back due to error:", err)
+		} else {
+			err = tx.Commit()
+			if err != nil {
+				log.Println("Error committing transaction:", err)
+			}
+		}
+	}()
+
+	// a migration may have dropped only some of the tables, start every one of them over
+	for _, table := range aggregateTables {
+		if _, err = tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+
+	aggregates, err := prepareAggregateStatements(tx)
+	if err != nil {
+		return err
+	}
+	defer aggregates.Close()
+
+	err = forEachEvent(tx, "WHERE number_of_participants = 1", func(event Event) error {
+		return aggregates.addEvent(event, eventPower(event))
+	})
+	return err
+}
+
+func queryItemAggregates() (map[Item]ItemAggregate, error) {
+	aggregates := make(map[Item]ItemAggregate)
+
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return aggregates, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, equivalence, slot, SUM(kills), SUM(deaths), SUM(sum_average_ip), SUM(sum_item_ip), SUM(sum_gear_ip), SUM(sum_mastery)
+		FROM item_daily_stats GROUP BY name, equivalence, slot`)
+	if err != nil {
+		log.Error("Failed to query item aggregates: ", err)
+		return aggregates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		var row ItemAggregate
+		if err := rows.Scan(&item.Name, &item.Tier, &row.Slot, &row.Kills, &row.Deaths, &row.SumAverageIp, &row.SumItemIp, &row.SumGearIp, &row.SumMastery); err != nil {
+			log.Error("Failed to scan item aggregate: ", err)
+			return aggregates, err
+		}
+		// an item is only ever worn in one slot, but keep the slot it was seen in most
+		aggregate, found := aggregates[item]
+		if found && aggregate.Kills+aggregate.Deaths >= row.Kills+row.Deaths {
+			row.Slot = aggregate.Slot
+		}
+		row.Kills += aggregate.Kills
+		row.Deaths += aggregate.Deaths
+		row.SumAverageIp += aggregate.SumAverageIp
+		row.SumItemIp += aggregate.SumItemIp
+		row.SumGearIp += aggregate.SumGearIp
+		row.SumMastery += aggregate.SumMastery
+		aggregates[item] = row
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying item aggregates: ", err)
+		return aggregates, err
+	}
+	return aggregates, nil
+}
+
+// queryValueItems returns every distinct item counted in a daily values table, so they can be priced
+// before the counts are read
+func queryValueItems(table string, condition string, args ...any) ([]Item, error) {
+	var items []Item
+
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return items, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT DISTINCT value_name, value_tier, value_enchantment, value_quality FROM %s %s`, table, condition), args...)
+	if err != nil {
+		log.Error("Failed to query items in ", table, ": ", err)
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.Name, &item.Tier, &item.Enchantment, &item.Quality); err != nil {
+			log.Error("Failed to scan value item: ", err)
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// forEachValueCount sums a daily values table over every day and calls fn for each row as it is read,
+// with the key columns scanned into key. The condition and its args narrow the rows read.
+func forEachValueCount(table string, keyColumns string, key []any, condition string, args []any, fn func(ValueCount) error) error {
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return err
+	}
+	defer db.Close()
+
+	query := fmt.Sprintf(`SELECT %[2]s, outcome, value_name, value_tier, value_enchantment, value_quality, SUM(count)
+		FROM %[1]s %[3]s GROUP BY %[2]s, outcome, value_name, value_tier, value_enchantment, value_quality`, table, keyColumns, condition)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Error("Failed to query ", table, ": ", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value ValueCount
+		destinations := append(append([]any{}, key...), &value.Outcome, &value.Item.Name, &value.Item.Tier, &value.Item.Enchantment, &value.Item.Quality, &value.Count)
+		if err := rows.Scan(destinations...); err != nil {
+			log.Error("Failed to scan value count: ", err)
+			return err
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying ", table, ": ", err)
+		return err
+	}
+	return nil
+}
+
+// itemValueCondition narrows item_daily_values to one item, or leaves it whole for an empty item
+func itemValueCondition(only Item) (string, []any) {
+	if only.Name == "" {
+		return "", nil
+	}
+	key := equivalentItem(only)
+	return "WHERE name = ? AND equivalence = ?", []any{key.Name, key.Tier}
+}
+
+func forEachItemValue(only Item, fn func(Item, ValueCount) error) error {
+	var item Item
+	condition, args := itemValueCondition(only)
+	return forEachValueCount("item_daily_values", "name, equivalence", []any{&item.Name, &item.Tier}, condition, args, func(value ValueCount) error {
+		return fn(item, value)
+	})
+}
+
+func forEachBuildValue(fn func(string, ValueCount) error) error {
+	var build string
+	return forEachValueCount("build_daily_values", "build_key", []any{&build}, "", nil, func(value ValueCount) error {
+		return fn(build, value)
+	})
+}
+
+// forEachBuildMatchup reads how often each stored build killed each other stored build
+func forEachBuildMatchup(fn func(killer string, victim string, count int64) error) error {
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT killer_build_key, victim_build_key, SUM(count) FROM build_daily_matchups GROUP BY killer_build_key, victim_build_key`)
+	if err != nil {
+		log.Error("Failed to query build matchups: ", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var killer, victim string
+		var count int64
+		if err := rows.Scan(&killer, &victim, &count); err != nil {
+			log.Error("Failed to scan build matchup: ", err)
+			return err
+		}
+		if err := fn(killer, victim, count); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying build matchups: ", err)
+		return err
+	}
+	return nil
+}
+
+func queryItemMatchups(ipBasis string) (map[Item][]Matchup, error) {
+	itemsToMatchups := make(map[Item][]Matchup)
+
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return itemsToMatchups, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, equivalence, ip_difference, won, SUM(count)
+		FROM item_daily_matchups WHERE ip_basis = ? GROUP BY name, equivalence, ip_difference, won`, ipBasis)
+	if err != nil {
+		log.Error("Failed to query item matchups: ", err)
+		return itemsToMatchups, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		var matchup Matchup
+		if err := rows.Scan(&item.Name, &item.Tier, &matchup.IpDifference, &matchup.Won, &matchup.Count); err != nil {
+			log.Error("Failed to scan item matchup: ", err)
+			return itemsToMatchups, err
+		}
+		itemsToMatchups[item] = append(itemsToMatchups[item], matchup)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying item matchups: ", err)
+		return itemsToMatchups, err
+	}
+	return itemsToMatchups, nil
+}
+
+// queryIpDifferences returns every solo fight's ip difference from the killer's side
+func queryIpDifferences(ipBasis string) ([]Matchup, error) {
+	var fights []Matchup
+
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return fights, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT ip_difference, SUM(count) FROM daily_ip_differences WHERE ip_basis = ? GROUP BY ip_difference`, ipBasis)
+	if err != nil {
+		log.Error("Failed to query ip differences: ", err)
+		return fights, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		fight := Matchup{Won: true}
+		if err := rows.Scan(&fight.IpDifference, &fight.Count); err != nil {
+			log.Error("Failed to scan ip difference: ", err)
+			return fights, err
+		}
+		fights = append(fights, fight)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying ip differences: ", err)
+		return fights, err
+	}
+	return fights, nil
+}
+
+func queryBuildAggregates() (map[string]BuildAggregate, error) {
+	aggregates := make(map[string]BuildAggregate)
+
+	db, err := sql.Open("sqlite3", config.Database)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return aggregates, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT build_key, SUM(kills), SUM(deaths), SUM(sum_average_ip) FROM build_daily_stats GROUP BY build_key`)
+	if err != nil {
+		log.Error("Failed to query build aggregates: ", err)
+		return aggregates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var build string
+		var aggregate BuildAggregate
+		if err := rows.Scan(&build, &aggregate.Kills, &aggregate.Deaths, &aggregate.SumAverageIp); err != nil {
+			log.Error("Failed to scan build aggregate: ", err)
+			return aggregates, err
+		}
+		aggregates[build] = aggregate
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("Row error encountered while querying build aggregates: ", err)
+		return aggregates, err
+	}
+	return aggregates, nil
+}
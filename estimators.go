@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	EstimatorMedian          = "median"
+	EstimatorTrimmedMean     = "trimmed_mean"
+	EstimatorMadMedian       = "mad_median"
+	EstimatorRecencyWeighted = "recency_weighted"
+	EstimatorOrder           = "order"
+	EstimatorProvided        = "provided"
+)
+
+type PriceSample struct {
+	Price     float64
+	Count     int64
+	Timestamp time.Time
+}
+
+type PriceEstimate struct {
+	Price   float64 `json:"price"`
+	Method  string  `json:"method"`
+	Samples int64   `json:"samples"`
+	Source  string  `json:"source"`
+}
+
+type LocationPrices map[string]PriceEstimate
+
+func validateEstimator(method string) error {
+	switch method {
+	case EstimatorMedian, EstimatorTrimmedMean, EstimatorMadMedian, EstimatorRecencyWeighted:
+		return nil
+	}
+	return fmt.Errorf("unknown price estimator: %s", method)
+}
+
+func estimatePrice(samples []PriceSample, method string) PriceEstimate {
+	var usable []PriceSample
+	for _, sample := range samples {
+		if sample.Price > 0.0 && sample.Count > 0 {
+			usable = append(usable, sample)
+		}
+	}
+	estimate := PriceEstimate{Method: method}
+	if len(usable) == 0 {
+		return estimate
+	}
+
+	switch method {
+	case EstimatorTrimmedMean:
+		estimate.Price = trimmedMean(usable, config.PriceTrimFraction)
+	case EstimatorMadMedian:
+		usable = rejectOutliers(usable, config.PriceMadThreshold)
+		estimate.Price = volumeMedian(usable)
+	case EstimatorRecencyWeighted:
+		estimate.Price = recencyWeightedMedian(usable, config.PriceRecencyHalfLife)
+	default:
+		estimate.Method = EstimatorMedian
+		estimate.Price = volumeMedian(usable)
+	}
+
+	for _, sample := range usable {
+		estimate.Samples += sample.Count
+	}
+	return estimate
+}
+
+func weightedMedian(values []float64, weights []float64) float64 {
+	indices := make([]int, len(values))
+	total := 0.0
+	for i := range values {
+		indices[i] = i
+		total += weights[i]
+	}
+	if total == 0.0 {
+		return 0.0
+	}
+	sort.Slice(indices, func(a, b int) bool {
+		return values[indices[a]] < values[indices[b]]
+	})
+
+	cumulative := 0.0
+	for position, index := range indices {
+		cumulative += weights[index]
+		if cumulative > total/2.0 {
+			return values[index]
+		}
+		if cumulative == total/2.0 && position+1 < len(indices) {
+			// an exact split lands between two values, same as an even length median
+			return (values[index] + values[indices[position+1]]) / 2.0
+		}
+	}
+	return values[indices[len(indices)-1]]
+}
+
+func volumeMedian(samples []PriceSample) float64 {
+	values := make([]float64, len(samples))
+	weights := make([]float64, len(samples))
+	for i, sample := range samples {
+		values[i] = sample.Price
+		weights[i] = float64(sample.Count)
+	}
+	return weightedMedian(values, weights)
+}
+
+func trimmedMean(samples []PriceSample, fraction float64) float64 {
+	sorted := append([]PriceSample{}, samples...)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Price < sorted[b].Price
+	})
+
+	total := 0.0
+	for _, sample := range sorted {
+		total += float64(sample.Count)
+	}
+	fraction = math.Min(math.Max(fraction, 0.0), 0.49)
+	low := total * fraction
+	high := total - low
+
+	// keep only the volume between the low and high cut, splitting records that straddle a cut
+	sum := 0.0
+	kept := 0.0
+	cumulative := 0.0
+	for _, sample := range sorted {
+		start := cumulative
+		cumulative += float64(sample.Count)
+		weight := math.Min(cumulative, high) - math.Max(start, low)
+		if weight > 0.0 {
+			sum += sample.Price * weight
+			kept += weight
+		}
+	}
+	if kept == 0.0 {
+		return volumeMedian(samples)
+	}
+	return sum / kept
+}
+
+func rejectOutliers(samples []PriceSample, threshold float64) []PriceSample {
+	median := volumeMedian(samples)
+
+	deviations := make([]float64, len(samples))
+	weights := make([]float64, len(samples))
+	for i, sample := range samples {
+		deviations[i] = math.Abs(sample.Price - median)
+		weights[i] = float64(sample.Count)
+	}
+	// scale the MAD so it estimates a standard deviation for normally distributed prices
+	mad := weightedMedian(deviations, weights) * 1.4826
+	if mad == 0.0 {
+		return samples
+	}
+
+	var kept []PriceSample
+	for i, sample := range samples {
+		if deviations[i] <= threshold*mad {
+			kept = append(kept, sample)
+		}
+	}
+	return kept
+}
+
+func recencyWeightedMedian(samples []PriceSample, halfLife time.Duration) float64 {
+	newest := samples[0].Timestamp
+	for _, sample := range samples {
+		if sample.Timestamp.After(newest) {
+			newest = sample.Timestamp
+		}
+	}
+
+	values := make([]float64, len(samples))
+	weights := make([]float64, len(samples))
+	for i, sample := range samples {
+		values[i] = sample.Price
+		weights[i] = float64(sample.Count)
+		if halfLife > 0 {
+			age := newest.Sub(sample.Timestamp)
+			weights[i] *= math.Pow(0.5, age.Hours()/halfLife.Hours())
+		}
+	}
+	return weightedMedian(values, weights)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	ValueTradableEquivalent = "tradable_equivalent"
+	ValueQualityNeighbor    = "quality_neighbor"
+	ValueInterpolated       = "interpolated"
+	ValueCraftingCost       = "crafting_cost"
+)
+
+const nonTradableSuffix = "_NONTRADABLE"
+
+func isNonTradable(item Item) bool {
+	return strings.HasSuffix(item.Name, nonTradableSuffix)
+}
+
+func tradableEquivalent(item Item) Item {
+	item.Name = strings.TrimSuffix(item.Name, nonTradableSuffix)
+	return item
+}
+
+func equivalentItem(item Item) Item {
+	item.Quality = 0
+	item.Tier = item.Tier + item.Enchantment
+	item.Enchantment = 0
+	return item
+}
+
+// estimateMissingPrices fills in itemPrices for items without a market price, returning how each
+// estimate was made so reports can flag them. The chain is tradable equivalent, then the same item at
+// a neighboring quality, then interpolation across tiers and enchantments, then crafting cost.
+func estimateMissingPrices(items []Item, itemPrices map[Item]float64, valuation Valuation) map[Item]string {
+	estimated := make(map[Item]string)
+	if !config.PriceEstimateMissing {
+		return estimated
+	}
+
+	var missing []Item
+	for _, item := range items {
+		if item.Name != "" && itemPrices[item] == 0.0 {
+			missing = append(missing, item)
+		}
+	}
+	if len(missing) == 0 {
+		return estimated
+	}
+
+	// tradable equivalents can be fetched like any other item
+	var equivalents []Item
+	for _, item := range missing {
+		if isNonTradable(item) {
+			equivalents = append(equivalents, tradableEquivalent(item))
+		}
+	}
+	if len(equivalents) != 0 {
+		equivalentPrices, err := getItemPrices(equivalents, valuation)
+		if err != nil {
+			log.Debug("Failed to get some tradable equivalent prices: ", err)
+		}
+		for _, item := range missing {
+			if price := equivalentPrices[tradableEquivalent(item)]; isNonTradable(item) && price != 0.0 {
+				itemPrices[item] = price
+				estimated[item] = ValueTradableEquivalent
+			}
+		}
+	}
+
+	// everything else is estimated from stored prices of the other variants of the same item
+	nameSet := make(map[string]bool)
+	for _, item := range missing {
+		if itemPrices[item] == 0.0 {
+			nameSet[tradableEquivalent(item).Name] = true
+		}
+	}
+	var names []string
+	for name := range nameSet {
+		names = append(names, name)
+	}
+	variantLocationPrices, err := queryPricesByName(names)
+	if err != nil {
+		log.Error("Failed to query price variants: ", err)
+		return estimated
+	}
+	variantPrices := valuePrices(variantLocationPrices, valuation)
+	for item, price := range itemPrices {
+		if price != 0.0 && nameSet[item.Name] {
+			variantPrices[item] = price
+		}
+	}
+
+	for _, item := range missing {
+		if itemPrices[item] != 0.0 {
+			continue
+		}
+		price, method := estimateFromVariants(tradableEquivalent(item), variantPrices)
+		if price != 0.0 {
+			itemPrices[item] = price
+			estimated[item] = method
+		}
+	}
+
+	estimateCraftingCosts(missing, itemPrices, estimated, valuation)
+
+	log.Debug("Estimated prices for ", len(estimated), " of ", len(missing), " unpriced items")
+	return estimated
+}
+
+func estimateFromVariants(item Item, variantPrices map[Item]float64) (float64, string) {
+	// the same tier and enchantment at the closest quality
+	for distance := uint8(1); distance <= 4; distance++ {
+		for _, quality := range []int{int(item.Quality) - int(distance), int(item.Quality) + int(distance)} {
+			if quality < 0 || quality > 4 {
+				continue
+			}
+			variant := item
+			variant.Quality = uint8(quality)
+			if price := variantPrices[variant]; price != 0.0 {
+				return price, ValueQualityNeighbor
+			}
+		}
+	}
+
+	// otherwise interpolate over the equivalent tier, preferring variants at the same quality
+	for _, sameQuality := range []bool{true, false} {
+		levelPrices := make(map[int][]float64)
+		for variant, price := range variantPrices {
+			if variant.Name != item.Name || price == 0.0 || (sameQuality && variant.Quality != item.Quality) {
+				continue
+			}
+			level := int(variant.Tier + variant.Enchantment)
+			levelPrices[level] = append(levelPrices[level], price)
+		}
+		points := make(map[int]float64)
+		for level, prices := range levelPrices {
+			points[level] = calculateMedian(prices)
+		}
+		if price := interpolatePrice(points, int(item.Tier+item.Enchantment)); price != 0.0 {
+			return price, ValueInterpolated
+		}
+	}
+
+	return 0.0, ""
+}
+
+// interpolatePrice interpolates geometrically between the closest known levels, or extrapolates
+// from the nearest ones when the level is outside the known range
+func interpolatePrice(points map[int]float64, level int) float64 {
+	if len(points) == 0 {
+		return 0.0
+	}
+	if price, found := points[level]; found {
+		return price
+	}
+
+	var lower, upper []int
+	for known := range points {
+		if known < level {
+			lower = append(lower, known)
+		} else {
+			upper = append(upper, known)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(lower)))
+	sort.Ints(upper)
+
+	if len(lower) != 0 && len(upper) != 0 {
+		below, above := lower[0], upper[0]
+		fraction := float64(level-below) / float64(above-below)
+		return points[below] * math.Pow(points[above]/points[below], fraction)
+	}
+
+	nearest := lower
+	if len(nearest) == 0 {
+		nearest = upper
+	}
+	growth := config.PriceLevelGrowth
+	if len(nearest) >= 2 {
+		growth = math.Pow(points[nearest[0]]/points[nearest[1]], 1.0/float64(nearest[0]-nearest[1]))
+	}
+	return points[nearest[0]] * math.Pow(growth, float64(level-nearest[0]))
+}
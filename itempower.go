@@ -0,0 +1,70 @@
+package main
+
+import "strings"
+
+const itemPowerPerTier = 100.0
+const itemPowerPerEnchantment = 100.0
+
+// base item power of a T4 item, each tier above or below adds or removes itemPowerPerTier
+const baseItemPowerT4 = 700.0
+
+// item power added by each quality, normal to masterpiece
+var qualityItemPower = []float64{0.0, 20.0, 40.0, 60.0, 100.0}
+
+// itemPower is the item power of one item without mastery bonuses. The base comes from the item
+// metadata when it is stored, since artifacts and some other items differ from the tier default.
+func itemPower(item Item) float64 {
+	if item.Name == "" || item.Tier == 0 {
+		return 0.0
+	}
+
+	base := baseItemPowerT4 + (float64(item.Tier)-4.0)*itemPowerPerTier
+	if meta, found := itemMetaFor(Item{Name: item.Name, Tier: item.Tier}); found && meta.ItemPower != 0.0 {
+		base = meta.ItemPower + (float64(item.Tier)-float64(meta.Item.Tier))*itemPowerPerTier
+	}
+
+	power := base + float64(item.Enchantment)*itemPowerPerEnchantment
+	if int(item.Quality) < len(qualityItemPower) {
+		power += qualityItemPower[item.Quality]
+	}
+	return power
+}
+
+func isTwoHanded(item Item) bool {
+	if meta, found := itemMetaFor(item); found {
+		return meta.TwoHanded
+	}
+	return strings.HasPrefix(item.Name, "2H_")
+}
+
+// buildItemPower averages the slots the game uses for average item power, a two handed weapon fills
+// both hands
+func buildItemPower(build Build) float64 {
+	mainHand := itemPower(build.MainHand)
+	offHand := itemPower(build.OffHand)
+	if build.OffHand.Name == "" && isTwoHanded(build.MainHand) {
+		offHand = mainHand
+	}
+
+	sum := 0.0
+	slots := 0
+	for _, power := range []float64{mainHand, offHand, itemPower(build.Head), itemPower(build.Chest), itemPower(build.Foot), itemPower(build.Cape)} {
+		if power != 0.0 {
+			sum += power
+			slots += 1
+		}
+	}
+	if slots == 0 {
+		return 0.0
+	}
+	return sum / float64(slots)
+}
+
+// impliedMastery is how much of the reported average item power doesn't come from the gear itself,
+// which is mostly spec and mastery
+func impliedMastery(gearIp float64, averageIp float64) float64 {
+	if gearIp == 0.0 || averageIp == 0.0 {
+		return 0.0
+	}
+	return averageIp - gearIp
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 )
 
@@ -142,8 +140,6 @@ func namesOnlyToItems(buildsNamesOnly []BuildNamesOnly, buildFilter BuildFilter)
 	return items
 }
 
-var humanReadableNames map[string]string
-
 func validHumanReadableItem(name string) bool {
 	return strings.HasPrefix(name, "T") &&
 		(strings.Contains(name, "_MAIN_") ||
@@ -181,27 +177,8 @@ func sanitizeHumanReadableItemName(humanReadableName string) string {
 	return humanReadableName
 }
 
-func updateHumanReadable() {
-	if humanReadableNames == nil {
-		humanReadableNames = make(map[string]string)
-	}
-
-	// Make HTTP GET request
-	resp, err := http.Get(config.ItemNamesUrl)
-	if err != nil {
-		fmt.Printf("Error fetching URL: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("Error reading response body: %v\n", err)
-		return
-	}
-
-	text := string(body)
+func parseHumanReadable(text string) map[string]string {
+	names := make(map[string]string)
 	lines := strings.Split(text, "\n")
 
 	for _, line := range lines {
@@ -213,40 +190,28 @@ func updateHumanReadable() {
 		key := strings.TrimSpace(parts[1])
 		value := strings.TrimSpace(parts[2])
 		if validHumanReadableItem(key) {
-			humanReadableNames[sanitizeItemName(key)] = sanitizeHumanReadableItemName(value)
+			names[sanitizeItemName(key)] = sanitizeHumanReadableItemName(value)
 		}
 	}
 
+	return names
 }
 
-func toHumanReadable(item Item, updateAllowed bool) (string, bool, error) {
-	updated := false
-	if humanReadableNames == nil {
-		updated = true
-		updateHumanReadable()
-	}
-	if humanReadableNames[item.Name] == "" && updateAllowed {
-		updated = true
-		updateHumanReadable()
-	}
-	if humanReadableNames[item.Name] == "" {
-		log.Error("Failed to get human readable name for item: ", item)
-		return item.Name, updated, fmt.Errorf("failed to get human readable name for item: %s", item.Name)
-	}
-	return humanReadableNames[item.Name], updated, nil
-}
-
-func manyToHumanReadable(items []Item) (map[string]string, error) {
+func manyToHumanReadable(items []Item, language string) (map[string]string, error) {
 	translation := make(map[string]string)
 	var errs []error
-	updated := false
+
+	language, err := normalizeLanguage(language)
+	if err != nil {
+		return translation, err
+	}
+	names := getItemNames()
 
 	for _, item := range items {
-		humanReadable, didUpdate, err := toHumanReadable(item, !updated)
-		updated = updated || didUpdate
-		if err != nil {
-			log.Error("Failed to get human readable name for item: ", item)
-			errs = append(errs, err)
+		humanReadable := names[language][item.Name]
+		if humanReadable == "" {
+			log.Error("Failed to get ", language, " name for item: ", item)
+			errs = append(errs, fmt.Errorf("failed to get %s name for item: %s", language, item.Name))
 			translation[item.Name] = item.Name
 		} else {
 			translation[item.Name] = humanReadable
@@ -260,46 +225,6 @@ func manyToHumanReadable(items []Item) (map[string]string, error) {
 	return translation, nil
 }
 
-func typeStringToItem(typeString string, quality uint8) (Item, error) {
-	var item Item
-	var err error
-
-	if typeString == "" {
-		return item, nil
-	}
-
-	item.Tier, err = parseUint8(fmt.Sprintf("%c", typeString[1]))
-	if err != nil {
-		log.Error("Failed to parse item string tier: ", typeString)
-		return item, err
-	}
-	typeString = typeString[3:]
-
-	if typeString[len(typeString)-2] == '@' {
-		item.Enchantment, err = parseUint8(fmt.Sprintf("%c", typeString[len(typeString)-1]))
-		if err != nil {
-			log.Error("Failed to parse item string enchantment: ", typeString)
-			return item, err
-		}
-		typeString = typeString[:len(typeString)-2]
-	} else {
-		item.Enchantment = 0
-	}
-
-	item.Name = typeString
-
-	item.Quality = quality
-
-	return item, nil
-}
-
-func itemToTypeString(item Item) string {
-	if item.Enchantment == 0 {
-		return fmt.Sprintf("T%d_%s", item.Tier, item.Name)
-	}
-	return fmt.Sprintf("T%d_%s@%d", item.Tier, item.Name, item.Enchantment)
-}
-
 func getItemsFromBuilds(builds []Build, filter BuildFilter) []Item {
 	var items []Item
 	for _, build := range builds {
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tidwall/gjson"
+)
+
+const LanguageEnglish = "EN-US"
+
+var languages = []string{
+	"EN-US", "DE-DE", "FR-FR", "RU-RU", "PL-PL", "ES-ES", "PT-BR", "IT-IT",
+	"ZH-CN", "KO-KR", "JA-JP", "ZH-TW", "ID-ID", "TR-TR", "AR-SA",
+}
+
+// normalizeLanguage accepts full codes like pt-BR as well as just the language like pt
+func normalizeLanguage(language string) (string, error) {
+	if language == "" {
+		language = config.DefaultLanguage
+	}
+	if language == "" {
+		return LanguageEnglish, nil
+	}
+	language = strings.ToUpper(strings.ReplaceAll(language, "_", "-"))
+	for _, known := range languages {
+		if language == known {
+			return known, nil
+		}
+	}
+	if !strings.Contains(language, "-") {
+		for _, known := range languages {
+			if strings.HasPrefix(known, language+"-") {
+				return known, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown language: %s", language)
+}
+
+// commonWords is the longest run of words shared by all tiers of an item, at the start or the end
+// depending on the language, which drops the tier title without knowing how each language words it
+func commonWords(names []string) string {
+	if len(names) < 2 {
+		if len(names) == 1 {
+			return names[0]
+		}
+		return ""
+	}
+
+	split := make([][]string, len(names))
+	for i, name := range names {
+		split[i] = strings.Fields(name)
+	}
+
+	var prefix, suffix []string
+	for i := 0; ; i++ {
+		if i >= len(split[0]) {
+			break
+		}
+		shared := true
+		for _, words := range split[1:] {
+			shared = shared && i < len(words) && words[i] == split[0][i]
+		}
+		if !shared {
+			break
+		}
+		prefix = append(prefix, split[0][i])
+	}
+	for i := 1; ; i++ {
+		if i > len(split[0]) {
+			break
+		}
+		word := split[0][len(split[0])-i]
+		shared := true
+		for _, words := range split[1:] {
+			shared = shared && i <= len(words) && words[len(words)-i] == word
+		}
+		if !shared {
+			break
+		}
+		suffix = append([]string{word}, suffix...)
+	}
+
+	if len(prefix) == 0 && len(suffix) == 0 {
+		return names[0]
+	}
+	if len(suffix) > len(prefix) {
+		return strings.Join(suffix, " ")
+	}
+	// names ending in the tier title leave a connecting word behind, like the des in Breitschwert des Adepten
+	for len(prefix) > 1 && !unicode.IsUpper([]rune(prefix[len(prefix)-1])[0]) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return strings.Join(prefix, " ")
+}
+
+func parseLocalizedNames(json string) map[string]map[string]string {
+	// sanitized item name -> language -> the name of each tier
+	tierNames := make(map[string]map[string][]string)
+
+	for _, entry := range gjson.Parse(json).Array() {
+		typeString := entry.Get("UniqueName").String()
+		if !validHumanReadableItem(typeString) || strings.Contains(typeString, "@") {
+			continue
+		}
+		name := sanitizeItemName(typeString)
+		if tierNames[name] == nil {
+			tierNames[name] = make(map[string][]string)
+		}
+		entry.Get("LocalizedNames").ForEach(func(key, value gjson.Result) bool {
+			language := strings.ToUpper(key.String())
+			if value.String() != "" {
+				tierNames[name][language] = append(tierNames[name][language], value.String())
+			}
+			return true // keep iterating
+		})
+	}
+
+	parsed := make(map[string]map[string]string)
+	for name, languageNames := range tierNames {
+		for language, names := range languageNames {
+			if parsed[language] == nil {
+				parsed[language] = make(map[string]string)
+			}
+			parsed[language][name] = commonWords(names)
+		}
+	}
+	return parsed
+}
@@ -8,6 +8,7 @@ import (
 
 var config Config = defaultConfig()
 var log = logrus.New()
+var refreshItems bool
 
 func crash(message string, err error) {
 	log.Error(message, err)
@@ -23,16 +24,39 @@ func main() {
 		crash("Failed while getting config: ", err)
 	}
 
+	err = validateConfig()
+	if err != nil {
+		crash("Invalid config: ", err)
+	}
+
 	err = initLogging()
 	if err != nil {
 		crash("Failed to initialize logging: ", err)
 	}
 
+	priceSource, err = newConfiguredPriceSource()
+	if err != nil {
+		crash("Failed to configure price sources: ", err)
+	}
+
 	err = initDatabase()
 	if err != nil {
 		crash("Failed to initialize database: ", err)
 	}
 
+	if refreshItems {
+		err = refreshItemMeta()
+		if err != nil {
+			crash("Failed to refresh item metadata: ", err)
+		}
+		return
+	}
+
+	err = rebuildAggregates()
+	if err != nil {
+		crash("Failed to rebuild aggregates: ", err)
+	}
+
 	log.Info("Config: ", config)
 	// Your application logic here
 
@@ -41,5 +65,13 @@ func main() {
 		go databaseCleanup()
 	}
 
+	if config.PriceRefreshInterval > 0 {
+		go priceRefresher()
+	}
+
+	if config.ItemNamesRefresh > 0 {
+		go itemNameRefresher()
+	}
+
 	startAPI()
 }
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+type ItemMeta struct {
+	Item        Item
+	Category    string
+	Subcategory string
+	SlotType    string
+	ItemPower   float64
+	TwoHanded   bool
+	Artifact    bool
+	Recipe      *Recipe
+}
+
+var itemMeta map[Item]ItemMeta
+var itemMetaByName map[string]ItemMeta
+var itemMetaLoaded time.Time
+var itemMetaMutex sync.Mutex
+
+// itemMetaRefreshMutex keeps loads and refreshes of the metadata from running concurrently
+var itemMetaRefreshMutex sync.Mutex
+
+// itemMetaRetryDelay is how long to wait before loading again when nothing could be loaded, empty
+// metadata is never cached so a failed first download doesn't last until the next refresh
+const itemMetaRetryDelay = time.Minute
+
+var itemMetaRetryAt time.Time
+
+func isTieredTypeString(typeString string) bool {
+	return len(typeString) > 3 && typeString[0] == 'T' && typeString[1] >= '1' && typeString[1] <= '8' && typeString[2] == '_'
+}
+
+// resultArray treats a single object the same as a one element array, the dump uses both
+func resultArray(result gjson.Result) []gjson.Result {
+	if !result.Exists() {
+		return nil
+	}
+	if result.IsArray() {
+		return result.Array()
+	}
+	return []gjson.Result{result}
+}
+
+func parseRecipe(item Item, requirements gjson.Result) (Recipe, bool) {
+	recipe := Recipe{Item: item, Amount: 1}
+	// some items list alternative recipes, the first one is the regular one
+	alternatives := resultArray(requirements)
+	if len(alternatives) == 0 {
+		return recipe, false
+	}
+	requirement := alternatives[0]
+	if amount := requirement.Get("@amountcrafted").Int(); amount > 0 {
+		recipe.Amount = amount
+	}
+
+	for _, resource := range resultArray(requirement.Get("craftresource")) {
+		typeString := resource.Get("@uniquename").String()
+		if !isTieredTypeString(typeString) {
+			return recipe, false
+		}
+		if level := resource.Get("@enchantmentlevel").Int(); level > 0 {
+			typeString = fmt.Sprintf("%s@%d", typeString, level)
+		}
+		ingredientItem, err := typeStringToItem(typeString, 0)
+		if err != nil {
+			return recipe, false
+		}
+		maxReturn := resource.Get("@maxreturnamount")
+		recipe.Ingredients = append(recipe.Ingredients, Ingredient{
+			Item:       ingredientItem,
+			Count:      resource.Get("@count").Int(),
+			Returnable: !maxReturn.Exists() || maxReturn.Int() != 0,
+		})
+	}
+	return recipe, len(recipe.Ingredients) != 0
+}
+
+func isArtifactRecipe(recipe Recipe) bool {
+	for _, ingredient := range recipe.Ingredients {
+		if strings.Contains(ingredient.Item.Name, "ARTEFACT_") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseItemMeta(json string) []ItemMeta {
+	var metas []ItemMeta
+
+	gjson.Get(json, "items").ForEach(func(_, group gjson.Result) bool {
+		for _, itemResult := range resultArray(group) {
+			typeString := itemResult.Get("@uniquename").String()
+			if !isTieredTypeString(typeString) {
+				continue
+			}
+			item, err := typeStringToItem(typeString, 0)
+			if err != nil {
+				continue
+			}
+
+			meta := ItemMeta{
+				Item:        item,
+				Category:    itemResult.Get("@shopcategory").String(),
+				Subcategory: itemResult.Get("@shopsubcategory1").String(),
+				SlotType:    itemResult.Get("@slottype").String(),
+				ItemPower:   itemResult.Get("@itempower").Float(),
+				TwoHanded:   itemResult.Get("@twohanded").Bool(),
+			}
+			if recipe, ok := parseRecipe(item, itemResult.Get("craftingrequirements")); ok {
+				meta.Recipe = &recipe
+				meta.Artifact = isArtifactRecipe(recipe)
+			}
+			metas = append(metas, meta)
+
+			for _, enchantment := range resultArray(itemResult.Get("enchantments.enchantment")) {
+				enchanted := meta
+				enchanted.Item.Enchantment = uint8(enchantment.Get("@enchantmentlevel").Int())
+				enchanted.Recipe = nil
+				if recipe, ok := parseRecipe(enchanted.Item, enchantment.Get("craftingrequirements")); ok {
+					enchanted.Recipe = &recipe
+				}
+				metas = append(metas, enchanted)
+			}
+		}
+		return true // keep iterating
+	})
+
+	return metas
+}
+
+// refreshItemMeta downloads the item dump and replaces the items_meta table
+func refreshItemMeta() error {
+	itemMetaRefreshMutex.Lock()
+	defer itemMetaRefreshMutex.Unlock()
+
+	if err := updateItemMeta(); err != nil {
+		return err
+	}
+	itemMetaMutex.Lock()
+	itemMeta = nil
+	itemMetaRetryAt = time.Time{}
+	itemMetaMutex.Unlock()
+	return nil
+}
+
+// updateItemMeta does the download and store of refreshItemMeta. The caller holds itemMetaRefreshMutex.
+func updateItemMeta() error {
+	response, err := http.Get(config.ItemDataUrl)
+	if err != nil {
+		log.Error("Failed to fetch item data: ", err)
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		log.Error("Failed to read item data: ", err)
+		return err
+	}
+	json := string(body)
+	if !gjson.Valid(json) {
+		log.Error("Invalid json response from url: ", config.ItemDataUrl)
+		return fmt.Errorf("invalid json response from url: %s", config.ItemDataUrl)
+	}
+
+	metas := parseItemMeta(json)
+	if len(metas) == 0 {
+		return fmt.Errorf("no items found in item data from url: %s", config.ItemDataUrl)
+	}
+	if err := replaceItemMeta(metas); err != nil {
+		log.Error("Failed to store item metadata: ", err)
+		return err
+	}
+	log.Info("Stored metadata for ", len(metas), " items")
+	return nil
+}
+
+// itemMetaFresh tells if metadata loaded at the time can still be used, a refresh interval of zero or
+// less never refreshes automatically
+func itemMetaFresh(loaded time.Time) bool {
+	return config.ItemDataRefresh <= 0 || time.Since(loaded) < config.ItemDataRefresh
+}
+
+// getItemMeta returns the stored item metadata, refreshing it first when it is missing or old
+func getItemMeta() (map[Item]ItemMeta, error) {
+	itemMetaMutex.Lock()
+	metas, loaded, retryAt := itemMeta, itemMetaLoaded, itemMetaRetryAt
+	itemMetaMutex.Unlock()
+	if metas != nil && itemMetaFresh(loaded) {
+		return metas, nil
+	}
+	if metas == nil && time.Now().Before(retryAt) {
+		return make(map[Item]ItemMeta), nil
+	}
+
+	itemMetaRefreshMutex.Lock()
+	defer itemMetaRefreshMutex.Unlock()
+
+	// another call may have loaded them, or failed to, while this one waited
+	itemMetaMutex.Lock()
+	metas, loaded, retryAt = itemMeta, itemMetaLoaded, itemMetaRetryAt
+	itemMetaMutex.Unlock()
+	if metas != nil && itemMetaFresh(loaded) {
+		return metas, nil
+	}
+	if metas == nil && time.Now().Before(retryAt) {
+		return make(map[Item]ItemMeta), nil
+	}
+
+	updated, err := getItemMetaUpdated()
+	if err != nil {
+		return nil, err
+	}
+	if config.ItemDataRefresh > 0 && time.Since(updated) > config.ItemDataRefresh {
+		if err := updateItemMeta(); err != nil {
+			log.Error("Failed to refresh item metadata, using stored metadata: ", err)
+		}
+	}
+
+	stored, err := queryItemMeta()
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) == 0 {
+		log.Error("No item metadata available, trying again in ", itemMetaRetryDelay)
+		itemMetaMutex.Lock()
+		itemMeta = nil
+		itemMetaRetryAt = time.Now().Add(itemMetaRetryDelay)
+		itemMetaMutex.Unlock()
+		return make(map[Item]ItemMeta), nil
+	}
+	metas = make(map[Item]ItemMeta)
+	byName := make(map[string]ItemMeta)
+	for _, meta := range stored {
+		metas[meta.Item] = meta
+		if _, found := byName[meta.Item.Name]; !found {
+			byName[meta.Item.Name] = meta
+		}
+	}
+
+	itemMetaMutex.Lock()
+	itemMeta = metas
+	itemMetaByName = byName
+	itemMetaLoaded = time.Now()
+	itemMetaMutex.Unlock()
+	return metas, nil
+}
+
+// itemMetaFor looks up metadata for any variant of an item, falling back to the unenchanted item and
+// then to any tier, since categories and flags are the same across tiers
+func itemMetaFor(item Item) (ItemMeta, bool) {
+	metas, err := getItemMeta()
+	if err != nil {
+		return ItemMeta{}, false
+	}
+	item = tradableEquivalent(item)
+	if meta, found := metas[Item{Name: item.Name, Tier: item.Tier, Enchantment: item.Enchantment}]; found {
+		return meta, true
+	}
+	if meta, found := metas[Item{Name: item.Name, Tier: item.Tier}]; found {
+		return meta, true
+	}
+
+	itemMetaMutex.Lock()
+	defer itemMetaMutex.Unlock()
+	meta, found := itemMetaByName[item.Name]
+	return meta, found
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// itemNames maps language and then item name to a display name. It is replaced as a whole and never
+// modified in place, so readers only need the lock to get the current map.
+var itemNames map[string]map[string]string
+var itemNamesMutex sync.RWMutex
+
+// itemNamesRefreshMutex keeps refreshes from running concurrently
+var itemNamesRefreshMutex sync.Mutex
+
+// itemNamesRetryDelay is how long to wait before loading again when no names could be loaded, an
+// empty map is never cached so a failed first fetch doesn't last until the next refresh
+const itemNamesRetryDelay = time.Minute
+
+// itemNamesRetryAt is guarded by itemNamesRefreshMutex
+var itemNamesRetryAt time.Time
+
+type ItemNameSource struct {
+	Url   string
+	Parse func(body string) (map[string]map[string]string, error)
+}
+
+func itemNameSources() []ItemNameSource {
+	return []ItemNameSource{
+		{Url: config.ItemNamesUrl, Parse: parseHumanReadableSource},
+		{Url: config.ItemLocalizedUrl, Parse: parseLocalizedSource},
+	}
+}
+
+func parseHumanReadableSource(body string) (map[string]map[string]string, error) {
+	return map[string]map[string]string{LanguageEnglish: parseHumanReadable(body)}, nil
+}
+
+// parseLocalizedSource leaves out english, which comes from items.txt
+func parseLocalizedSource(body string) (map[string]map[string]string, error) {
+	if !gjson.Valid(body) {
+		return nil, fmt.Errorf("invalid json in localized item names")
+	}
+	names := parseLocalizedNames(body)
+	delete(names, LanguageEnglish)
+	return names, nil
+}
+
+// readItemNamesFile loads names from a local copy of items.txt, or of the localized items.json which
+// has every language
+func readItemNamesFile(path string) (map[string]map[string]string, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if !gjson.Valid(string(body)) {
+			return nil, fmt.Errorf("invalid json in item names file: %s", path)
+		}
+		return parseLocalizedNames(string(body)), nil
+	}
+	return parseHumanReadableSource(string(body))
+}
+
+// fetchIfChanged does a conditional GET, returning an empty body when the ETag still matches
+func fetchIfChanged(url string, etag string) (string, string, bool, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", false, err
+	}
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified {
+		return "", etag, false, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", "", false, fmt.Errorf("unexpected status %s from url: %s", response.Status, url)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", "", false, err
+	}
+	return string(body), response.Header.Get("ETag"), true, nil
+}
+
+// updateItemNames stores names from the local file, or from every source not checked within maxAge.
+// The caller holds itemNamesRefreshMutex.
+func updateItemNames(maxAge time.Duration) error {
+	if config.ItemNamesFile != "" {
+		names, err := readItemNamesFile(config.ItemNamesFile)
+		if err != nil {
+			log.Error("Failed to read item names file: ", err)
+			return err
+		}
+		return storeItemNames(names)
+	}
+
+	var errs []error
+	for _, source := range itemNameSources() {
+		etag, updated, err := getItemNameSource(source.Url)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if time.Since(updated) < maxAge {
+			continue
+		}
+
+		body, etag, changed, err := fetchIfChanged(source.Url, etag)
+		if err != nil {
+			log.Error("Failed to fetch item names: ", err)
+			errs = append(errs, err)
+			continue
+		}
+		if changed {
+			names, err := source.Parse(body)
+			if err != nil {
+				log.Error("Failed to parse item names from url: ", source.Url)
+				errs = append(errs, err)
+				continue
+			}
+			if err := storeItemNames(names); err != nil {
+				log.Error("Failed to store item names: ", err)
+				errs = append(errs, err)
+				continue
+			}
+			log.Info("Stored item names from url: ", source.Url)
+		}
+		if err := updateItemNameSource(source.Url, etag); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// reloadItemNames leaves the cache unset when nothing is stored, so the next use tries again
+func reloadItemNames() error {
+	names, err := queryItemNames()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = nil
+	}
+	itemNamesMutex.Lock()
+	itemNames = names
+	itemNamesMutex.Unlock()
+	return nil
+}
+
+// refreshItemNames checks every source for changes and reloads the cache
+func refreshItemNames() error {
+	itemNamesRefreshMutex.Lock()
+	defer itemNamesRefreshMutex.Unlock()
+
+	err := updateItemNames(0)
+	if err != nil {
+		log.Error("Failed to refresh some item names: ", err)
+	}
+	if reloadErr := reloadItemNames(); reloadErr != nil {
+		return reloadErr
+	}
+	return err
+}
+
+func itemNameRefresher() {
+	for {
+		time.Sleep(config.ItemNamesRefresh)
+		refreshItemNames()
+	}
+}
+
+// getItemNames returns the cached names, loading them from the database on first use and only
+// fetching when the stored names are missing or older than item_names_refresh
+func getItemNames() map[string]map[string]string {
+	itemNamesMutex.RLock()
+	names := itemNames
+	itemNamesMutex.RUnlock()
+	if names != nil {
+		return names
+	}
+
+	itemNamesRefreshMutex.Lock()
+	defer itemNamesRefreshMutex.Unlock()
+
+	// another request may have loaded them while this one waited
+	itemNamesMutex.RLock()
+	names = itemNames
+	itemNamesMutex.RUnlock()
+	if names != nil {
+		return names
+	}
+	if time.Now().Before(itemNamesRetryAt) {
+		return make(map[string]map[string]string)
+	}
+
+	if err := updateItemNames(config.ItemNamesRefresh); err != nil {
+		log.Error("Failed to update item names, using stored names: ", err)
+	}
+	if err := reloadItemNames(); err != nil {
+		log.Error("Failed to load item names: ", err)
+	}
+
+	itemNamesMutex.RLock()
+	names = itemNames
+	itemNamesMutex.RUnlock()
+	if names == nil {
+		log.Error("No item names available, trying again in ", itemNamesRetryDelay)
+		itemNamesRetryAt = time.Now().Add(itemNamesRetryDelay)
+		return make(map[string]map[string]string)
+	}
+	return names
+}
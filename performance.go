@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	IpBasisReported = "reported"
+	IpBasisGear     = "gear"
+)
+
+// ip differences are fitted in hundreds of item power, which keeps the coefficient near 1
+const ipDifferenceScale = 100.0
+
+// itemEffectPenalty shrinks item effects towards zero, so an item that won its only two fights
+// gets a large but finite effect
+const itemEffectPenalty = 1.0
+
+// Matchup is a number of fights with the same outcome and ip difference, seen from one side
+type Matchup struct {
+	Won          bool
+	IpDifference float64
+	Count        int64
+}
+
+func validateIpBasis(ipBasis string) error {
+	if ipBasis != IpBasisReported && ipBasis != IpBasisGear {
+		return fmt.Errorf("invalid ipBasis: %s", ipBasis)
+	}
+	return nil
+}
+
+func sigmoid(x float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-x))
+}
+
+// fitIpCoefficient fits P(win) = sigmoid(b * difference) over every fight, given from the killer's side
+// and counted once as a win and once from the victim's side as a loss, so no intercept is needed
+func fitIpCoefficient(fights []Matchup) float64 {
+	coefficient := 0.0
+	for iteration := 0; iteration < 50; iteration++ {
+		gradient, curvature := 0.0, 0.0
+		for _, fight := range fights {
+			x := fight.IpDifference / ipDifferenceScale
+			count := float64(fight.Count)
+			for _, sample := range []struct{ x, won float64 }{{x, 1.0}, {-x, 0.0}} {
+				p := sigmoid(coefficient * sample.x)
+				gradient += count * (sample.won - p) * sample.x
+				curvature += count * p * (1.0 - p) * sample.x * sample.x
+			}
+		}
+		if curvature == 0.0 {
+			return coefficient
+		}
+		step := gradient / curvature
+		coefficient += step
+		if math.Abs(step) < 1e-9 {
+			break
+		}
+	}
+	return coefficient
+}
+
+// itemEffect returns the win rate of an item, the win rate its ip differences alone would predict, and
+// the log-odds the item adds on top of the ip difference. A positive effect means the item wins more
+// than its item power explains.
+func itemEffect(matchups []Matchup, coefficient float64) (float64, float64, float64) {
+	wins, expected, count := 0.0, 0.0, 0.0
+	for _, matchup := range matchups {
+		if matchup.Won {
+			wins += float64(matchup.Count)
+		}
+		expected += float64(matchup.Count) * sigmoid(coefficient*matchup.IpDifference/ipDifferenceScale)
+		count += float64(matchup.Count)
+	}
+	if count == 0.0 {
+		return 0.0, 0.0, 0.0
+	}
+
+	effect := 0.0
+	for iteration := 0; iteration < 50; iteration++ {
+		gradient, curvature := -itemEffectPenalty*effect, itemEffectPenalty
+		for _, matchup := range matchups {
+			p := sigmoid(effect + coefficient*matchup.IpDifference/ipDifferenceScale)
+			won := 0.0
+			if matchup.Won {
+				won = 1.0
+			}
+			gradient += float64(matchup.Count) * (won - p)
+			curvature += float64(matchup.Count) * p * (1.0 - p)
+		}
+		step := gradient / curvature
+		effect += step
+		if math.Abs(step) < 1e-9 {
+			break
+		}
+	}
+
+	return wins / count, expected / count, effect
+}
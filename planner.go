@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxPriceUrlLength = 2048
+
+const historyParams = "&time-scale=6"
+
+type PriceRequest struct {
+	Url   string
+	Items []Item
+}
+
+func (request PriceRequest) wants(item Item) bool {
+	for _, requested := range request.Items {
+		if requested == item {
+			return true
+		}
+	}
+	return false
+}
+
+// planPriceRequests packs items into as few URLs as fit under maxPriceUrlLength. Items wanted at the
+// same set of qualities share a request, since the API returns every item at every requested quality.
+func planPriceRequests(baseUrl string, extraParams string, items []Item) []PriceRequest {
+	var typeStrings []string
+	typeQualities := make(map[string][]uint8)
+	for _, item := range items {
+		typeString := itemToTypeString(item)
+		qualities, found := typeQualities[typeString]
+		if !found {
+			typeStrings = append(typeStrings, typeString)
+		}
+		duplicate := false
+		for _, quality := range qualities {
+			duplicate = duplicate || quality == item.Quality
+		}
+		if !duplicate {
+			typeQualities[typeString] = append(qualities, item.Quality)
+		}
+	}
+
+	var qualityKeys []string
+	qualityGroups := make(map[string][]string)
+	for _, typeString := range typeStrings {
+		qualities := typeQualities[typeString]
+		sort.Slice(qualities, func(a, b int) bool { return qualities[a] < qualities[b] })
+		var apiQualities []string
+		for _, quality := range qualities {
+			apiQualities = append(apiQualities, fmt.Sprintf("%d", quality+1))
+		}
+		key := strings.Join(apiQualities, ",")
+		if _, found := qualityGroups[key]; !found {
+			qualityKeys = append(qualityKeys, key)
+		}
+		qualityGroups[key] = append(qualityGroups[key], typeString)
+	}
+
+	var locations []string
+	for _, location := range priceLocations() {
+		locations = append(locations, url.PathEscape(location))
+	}
+
+	var requests []PriceRequest
+	for _, key := range qualityKeys {
+		prefix := baseUrl + "/"
+		suffix := ".json?locations=" + strings.Join(locations, ",") + "&qualities=" + key + extraParams
+
+		var itemList []string
+		var requestItems []Item
+		length := len(prefix) + len(suffix)
+		flush := func() {
+			if len(itemList) != 0 {
+				requests = append(requests, PriceRequest{
+					Url:   prefix + strings.Join(itemList, ",") + suffix,
+					Items: requestItems,
+				})
+			}
+			itemList = nil
+			requestItems = nil
+			length = len(prefix) + len(suffix)
+		}
+
+		for _, typeString := range qualityGroups[key] {
+			escaped := url.PathEscape(typeString)
+			added := len(escaped)
+			if len(itemList) != 0 {
+				added += 1 // separating comma
+			}
+			if len(itemList) != 0 && length+added > maxPriceUrlLength {
+				flush()
+				added = len(escaped)
+			}
+			itemList = append(itemList, escaped)
+			length += added
+			for _, quality := range typeQualities[typeString] {
+				item, err := typeStringToItem(typeString, quality)
+				if err != nil {
+					log.Error("Failed to parse planned type string: ", typeString)
+					continue
+				}
+				requestItems = append(requestItems, item)
+			}
+		}
+		flush()
+	}
+
+	return requests
+}
+
+type rateLimiter struct {
+	mutex sync.Mutex
+	next  time.Time
+}
+
+var priceRateLimiter rateLimiter
+
+func (limiter *rateLimiter) wait(perMinute int) {
+	if perMinute <= 0 {
+		return
+	}
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Minute / time.Duration(perMinute))
+	limiter.mutex.Unlock()
+
+	time.Sleep(delay)
+}
+
+func runPriceRequests(requests []PriceRequest, call func(PriceRequest) (map[Item]LocationPrices, error)) (map[Item]LocationPrices, error) {
+	prices := make(map[Item]LocationPrices)
+	var errs []error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	requestChan := make(chan PriceRequest, len(requests))
+	for _, request := range requests {
+		requestChan <- request
+	}
+	close(requestChan)
+
+	workers := config.PriceConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for request := range requestChan {
+				priceRateLimiter.wait(config.PriceRequestRate)
+				requestPrices, err := call(request)
+
+				mutex.Lock()
+				if err != nil {
+					log.Error("Price request failed: ", request.Url)
+					errs = append(errs, err)
+				}
+				mergeMissingPrices(prices, requestPrices)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return prices, fmt.Errorf("%v", errs)
+	}
+	return prices, nil
+}
+
+type priceCall struct {
+	done   chan struct{}
+	prices LocationPrices
+}
+
+var inFlightPrices = make(map[Item]*priceCall)
+var inFlightMutex sync.Mutex
+
+// fetchPrices asks the configured price source for items, waiting on concurrent callers that are
+// already fetching some of them instead of requesting those again
+func fetchPrices(items []Item) (map[Item]LocationPrices, error) {
+	var ownedItems []Item
+	owned := make(map[Item]*priceCall)
+	waiting := make(map[Item]*priceCall)
+
+	inFlightMutex.Lock()
+	for _, item := range items {
+		if call, found := inFlightPrices[item]; found {
+			if owned[item] == nil {
+				waiting[item] = call
+			}
+			continue
+		}
+		call := &priceCall{done: make(chan struct{})}
+		inFlightPrices[item] = call
+		owned[item] = call
+		ownedItems = append(ownedItems, item)
+	}
+	inFlightMutex.Unlock()
+
+	var prices map[Item]LocationPrices
+	var err error
+	if len(ownedItems) != 0 {
+		prices, err = priceSource.FetchPrices(ownedItems)
+	}
+	if prices == nil {
+		prices = make(map[Item]LocationPrices)
+	}
+
+	inFlightMutex.Lock()
+	for item, call := range owned {
+		call.prices = prices[item]
+		delete(inFlightPrices, item)
+		close(call.done)
+	}
+	inFlightMutex.Unlock()
+
+	for item, call := range waiting {
+		<-call.done
+		if call.prices != nil {
+			prices[item] = call.prices
+		}
+	}
+
+	return prices, err
+}
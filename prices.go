@@ -6,15 +6,122 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
 
-func getItemPrices(items []Item) (map[Item]float64, error) {
-	var discoveredPrices map[Item]float64
+const (
+	ValuationCheapest    = "cheapest"
+	ValuationCity        = "city"
+	ValuationMedian      = "median"
+	ValuationBlackMarket = "black_market"
+)
+
+const (
+	PriceSourceHistory = "history"
+	PriceSourceCurrent = "current"
+	PriceSourceFile    = "file"
+	PriceSourceSellMin = "sell_min"
+	PriceSourceBuyMax  = "buy_max"
+)
+
+type Valuation struct {
+	Mode string
+	City string
+}
+
+// defaultValuation is the configured valuation, cheapest when the config doesn't set one
+func defaultValuation() Valuation {
+	mode := config.PriceValuation
+	if mode == "" {
+		mode = ValuationCheapest
+	}
+	return Valuation{Mode: mode, City: config.PriceValuationCity}
+}
+
+func normalizeLocation(location string) string {
+	return strings.ReplaceAll(location, " ", "")
+}
+
+func validateValuation(valuation Valuation) error {
+	switch valuation.Mode {
+	case ValuationCheapest, ValuationMedian, ValuationBlackMarket:
+		return nil
+	case ValuationCity:
+		for _, location := range config.PriceLocations {
+			if normalizeLocation(location) == normalizeLocation(valuation.City) {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown price city: %s", valuation.City)
+	}
+	return fmt.Errorf("unknown price valuation: %s", valuation.Mode)
+}
+
+func valuePrice(locationPrices LocationPrices, valuation Valuation) float64 {
+	blackMarket := normalizeLocation(config.BlackMarketLocation)
+
+	switch valuation.Mode {
+	case ValuationCity:
+		return locationPrices[normalizeLocation(valuation.City)].Price
+	case ValuationBlackMarket:
+		return locationPrices[blackMarket].Price
+	case ValuationMedian:
+		var prices []float64
+		for location, estimate := range locationPrices {
+			if location != blackMarket && estimate.Price != 0.0 {
+				prices = append(prices, estimate.Price)
+			}
+		}
+		return calculateMedian(prices)
+	}
+
+	cheapest := 0.0
+	for location, estimate := range locationPrices {
+		if location == blackMarket || estimate.Price == 0.0 {
+			continue
+		}
+		if cheapest == 0.0 || estimate.Price < cheapest {
+			cheapest = estimate.Price
+		}
+	}
+	return cheapest
+}
+
+func valuePrices(itemLocationPrices map[Item]LocationPrices, valuation Valuation) map[Item]float64 {
+	itemPrices := make(map[Item]float64)
+	for item, locationPrices := range itemLocationPrices {
+		price := valuePrice(locationPrices, valuation)
+		if price != 0.0 {
+			itemPrices[item] = price
+		}
+	}
+	return itemPrices
+}
+
+func getItemPrices(items []Item, valuation Valuation) (map[Item]float64, error) {
+	itemLocationPrices, err := getItemLocationPrices(items)
+	itemPrices := valuePrices(itemLocationPrices, valuation)
+	if err != nil {
+		return itemPrices, err
+	}
+
+	for _, item := range items {
+		if itemPrices[item] == 0.0 {
+			log.Debug("No ", valuation.Mode, " price for item: ", item)
+			err = fmt.Errorf("no %s price for at least one item", valuation.Mode)
+		}
+	}
+
+	return itemPrices, err
+}
+
+func getItemLocationPrices(items []Item) (map[Item]LocationPrices, error) {
+	var discoveredPrices map[Item]LocationPrices
 	var unknownItems []Item
 	var err error
-	var itemPrices map[Item]float64
+	var itemPrices map[Item]LocationPrices
 
 	itemPrices, err = queryPrices(items)
 	if err != nil {
@@ -23,31 +130,31 @@ func getItemPrices(items []Item) (map[Item]float64, error) {
 	}
 
 	for _, item := range items {
-		if itemPrices[item] == 0.0 {
+		if len(itemPrices[item]) == 0 && !isNonTradable(item) {
 			unknownItems = append(unknownItems, item)
 		}
 	}
 
 	if len(unknownItems) > 0 {
 		log.Debug("Unknown items: ", unknownItems)
-		discoveredPrices, err = callPriceAPI(unknownItems)
+		// a failing source can still return what the others found, so keep going
+		discoveredPrices, err = fetchPrices(unknownItems)
 		if err != nil {
-			log.Error("Failed to call price API for prices for: ", unknownItems)
-			return itemPrices, err
+			log.Error("Failed to fetch prices from ", priceSource.Name(), " for: ", unknownItems)
 		}
 		err = updatePrices(discoveredPrices)
 		if err != nil {
 			log.Error("Failed to update prices for items: ", discoveredPrices)
 			return itemPrices, err
 		}
-		for item, price := range discoveredPrices {
-			itemPrices[item] = price
+		for item, locationPrices := range discoveredPrices {
+			itemPrices[item] = locationPrices
 		}
 	}
 
 	err = nil
 	for _, item := range items {
-		if itemPrices[item] == 0.0 {
+		if len(itemPrices[item]) == 0 {
 			log.Debug("Failed to query or call API for item price: ", item)
 			err = fmt.Errorf("failed to query or call API for at least one item")
 		}
@@ -56,76 +163,89 @@ func getItemPrices(items []Item) (map[Item]float64, error) {
 	return itemPrices, err
 }
 
-func callPriceAPI(items []Item) (map[Item]float64, error) {
-	log.Debug("Calling price API for items: ", items)
-	prices := make(map[Item]float64)
-	qualityToItems := make(map[uint8][]Item)
+func getPriceJson(url string) (gjson.Result, error) {
+	log.Debug("Calling price url: ", url)
+	response, err := http.Get(url)
+	if err != nil {
+		log.Error("The HTTP request failed with error ", err)
+		return gjson.Result{}, fmt.Errorf("the HTTP request failed with error %s", err)
+	}
+	defer response.Body.Close()
 
-	for _, item := range items {
-		qualityToItems[item.Quality] = append(qualityToItems[item.Quality], item)
+	// Read the response body
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		log.Error("Failed to read the response body: ", err)
+		return gjson.Result{}, fmt.Errorf("failed to read the response body: %s", err)
 	}
 
-	for quality, itemsAtQuality := range qualityToItems {
-		qualityPrices, err := callPriceAPIForQuality(itemsAtQuality, quality)
-		if err != nil {
-			log.Error("Failed to call pricing api for items: ", itemsAtQuality)
-		}
-		for item, price := range qualityPrices {
-			prices[item] = price
-		}
+	// Use Gjson to parse and query the JSON response
+	json := string(body)
+	if !gjson.Valid(json) {
+		log.Error("Invalid json resonse from url: ", url)
+		return gjson.Result{}, fmt.Errorf("invalid json response from url: %s", url)
 	}
+	return gjson.Parse(json), nil
+}
 
-	return prices, nil
+func resultToPriceItem(result gjson.Result) (Item, error) {
+	// the API numbers qualities from 1
+	quality := result.Get("quality").Int() - 1
+	if quality < 0 {
+		quality = 0
+	}
+	return typeStringToItem(result.Get("item_id").String(), uint8(quality))
 }
 
-func callPriceAPIForQuality(items []Item, quality uint8) (map[Item]float64, error) {
-	prices := make(map[Item]float64)
-	urls := getPriceAPIUrls(items, quality)
+func callPriceAPI(request PriceRequest) (map[Item]LocationPrices, error) {
+	prices := make(map[Item]LocationPrices)
+	sampleGroups := make(map[Item]map[string][]PriceSample)
 
-	for _, url := range urls {
-		priceGroups := make(map[string][]float64)
-		log.Debug("Calling price url: ", url)
-		response, err := http.Get(url)
-		if err != nil {
-			log.Error("The HTTP request failed with error ", err)
-			return prices, fmt.Errorf("the HTTP request failed with error %s", err)
-		}
-		defer response.Body.Close()
+	results, err := getPriceJson(request.Url)
+	if err != nil {
+		return prices, err
+	}
 
-		// Read the response body
-		body, err := io.ReadAll(response.Body)
+	// Group the price records by item and location
+	var parseErr error
+	results.ForEach(func(_, result gjson.Result) bool {
+		item, err := resultToPriceItem(result)
 		if err != nil {
-			log.Error("Failed to read the response body: ", err)
-			return prices, fmt.Errorf("failed to read the response body: %s", err)
-
+			log.Error("Failed to parse type string: ", result.Get("item_id").String())
+			parseErr = err
+			return false
 		}
-
-		// Use Gjson to parse and query the JSON response
-		json := string(body)
-		if !gjson.Valid(json) {
-			log.Error("Invalid json resonse from url: ", url)
-			return prices, fmt.Errorf("invalid json response from url: %s", url)
+		if !request.wants(item) {
+			return true
+		}
+		location := normalizeLocation(result.Get("location").String())
+		if sampleGroups[item] == nil {
+			sampleGroups[item] = make(map[string][]PriceSample)
 		}
-		// Example: Iterate over all events and print the Killer's Name
-		gjson.Parse(json).ForEach(func(_, result gjson.Result) bool {
-			for _, priceRecord := range result.Get("data").Array() {
-				count := priceRecord.Get("item_count").Int()
-				price := priceRecord.Get("avg_price").Float()
-				if price != 0.0 {
-					for range count {
-						priceGroups[result.Get("item_id").String()] = append(priceGroups[result.Get("item_id").String()], price)
-					}
-				}
+		for _, priceRecord := range result.Get("data").Array() {
+			sampleGroups[item][location] = append(sampleGroups[item][location], PriceSample{
+				Price:     priceRecord.Get("avg_price").Float(),
+				Count:     priceRecord.Get("item_count").Int(),
+				Timestamp: parsePriceTimestamp(priceRecord.Get("timestamp").String()),
+			})
+		}
+		return true // keep iterating
+	})
+	if parseErr != nil {
+		return prices, parseErr
+	}
+
+	for item, locationGroups := range sampleGroups {
+		for location, samples := range locationGroups {
+			estimate := estimatePrice(samples, config.PriceEstimator)
+			estimate.Source = PriceSourceHistory
+			if estimate.Price == 0.0 {
+				continue
 			}
-			return true // keep iterating
-		})
-		for typeString, itemPrices := range priceGroups {
-			item, err := typeStringToItem(typeString, quality)
-			if err != nil {
-				log.Error("Failed to parse type string: ", typeString)
-				return prices, err
+			if prices[item] == nil {
+				prices[item] = make(LocationPrices)
 			}
-			prices[item] = calculateMedian(itemPrices)
+			prices[item][location] = estimate
 		}
 	}
 	log.Info("Got prices: ", prices)
@@ -133,37 +253,77 @@ func callPriceAPIForQuality(items []Item, quality uint8) (map[Item]float64, erro
 	return prices, nil
 }
 
-func makeUrl(itemList string, locations string, quality uint8) string {
-	return config.PriceUrl + "/" + itemList + ".json?locations=" + locations + "&qualities=" + fmt.Sprintf("%d", quality+1) + "&time-scale=6"
-}
+func callCurrentPriceAPI(request PriceRequest) (map[Item]LocationPrices, error) {
+	prices := make(map[Item]LocationPrices)
 
-func getPriceAPIUrls(items []Item, quality uint8) []string {
-	var locations string
-	for _, location := range config.PriceLocations {
-		locations += location + ","
+	results, err := getPriceJson(request.Url)
+	if err != nil {
+		return prices, err
 	}
-	locations = locations[:len(locations)-1]
-	var urls []string
 
-	i := 0
-	var itemList string
-
-	for _, item := range items {
-		if i == 50 { // TODO: make this actually respect the 2048 character URL limit, rather than just guessing at 50
-			i = 0
-			itemList = itemList[:len(itemList)-1]
-			urls = append(urls, makeUrl(itemList, locations, quality))
-			itemList = ""
+	var parseErr error
+	results.ForEach(func(_, result gjson.Result) bool {
+		estimate := currentOrderEstimate(result)
+		if estimate.Price == 0.0 {
+			return true
 		}
-		i += 1
-		itemList += itemToTypeString(item) + ","
+		item, err := resultToPriceItem(result)
+		if err != nil {
+			log.Error("Failed to parse type string: ", result.Get("item_id").String())
+			parseErr = err
+			return false
+		}
+		if !request.wants(item) {
+			return true
+		}
+		if prices[item] == nil {
+			prices[item] = make(LocationPrices)
+		}
+		prices[item][normalizeLocation(result.Get("city").String())] = estimate
+		return true // keep iterating
+	})
+	if parseErr != nil {
+		return prices, parseErr
+	}
+	log.Info("Got current prices: ", prices)
+
+	return prices, nil
+}
+
+func currentOrderEstimate(result gjson.Result) PriceEstimate {
+	// the lowest sell order is what a buyer would pay, the highest buy order is a floor
+	sellMin := result.Get("sell_price_min").Float()
+	sellMinDate := parsePriceTimestamp(result.Get("sell_price_min_date").String())
+	if sellMin != 0.0 && time.Since(sellMinDate) <= config.PriceStaleThreshold {
+		return PriceEstimate{Price: sellMin, Method: EstimatorOrder, Samples: 1, Source: PriceSourceSellMin}
 	}
-	if itemList != "" {
-		itemList = itemList[:len(itemList)-1]
-		urls = append(urls, makeUrl(itemList, locations, quality))
+	buyMax := result.Get("buy_price_max").Float()
+	buyMaxDate := parsePriceTimestamp(result.Get("buy_price_max_date").String())
+	if buyMax != 0.0 && time.Since(buyMaxDate) <= config.PriceStaleThreshold {
+		return PriceEstimate{Price: buyMax, Method: EstimatorOrder, Samples: 1, Source: PriceSourceBuyMax}
 	}
+	return PriceEstimate{}
+}
 
-	return urls
+func parsePriceTimestamp(timestamp string) time.Time {
+	// the API omits the zone, timestamps are UTC
+	parsed, err := time.Parse("2006-01-02T15:04:05", timestamp)
+	if err != nil {
+		log.Debug("Failed to parse price timestamp: ", timestamp)
+		return time.Time{}
+	}
+	return parsed
+}
+
+func priceLocations() []string {
+	var locations []string
+	for _, location := range config.PriceLocations {
+		locations = append(locations, normalizeLocation(location))
+	}
+	if config.BlackMarketLocation != "" {
+		locations = append(locations, normalizeLocation(config.BlackMarketLocation))
+	}
+	return locations
 }
 
 func calculateMedian(data []float64) float64 {
@@ -186,6 +346,58 @@ func calculateMedian(data []float64) float64 {
 	}
 }
 
+func priceRefresher() {
+	for {
+		refreshPrices()
+		time.Sleep(config.PriceRefreshInterval)
+	}
+}
+
+func refreshPrices() {
+	// refresh anything that would go stale before the next few cycles get a chance to
+	updatedBefore := time.Now().Add(-config.PriceStaleThreshold).Add(config.PriceRefreshMargin)
+	attemptedBefore := time.Now().Add(-config.PriceRefreshRetry)
+	items, err := queryRefreshCandidates(updatedBefore, attemptedBefore, config.PriceRefreshItems)
+	if err != nil {
+		log.Error("Failed to query items for price refresh: ", err)
+		return
+	}
+	if len(items) == 0 {
+		log.Debug("No prices need refreshing")
+		return
+	}
+
+	// each planned request costs roughly one call per source, spend the budget on the most referenced items first
+	requests := planPriceRequests(config.PriceUrl, historyParams, items)
+	if len(requests) > config.PriceRefreshBudget {
+		requests = requests[:config.PriceRefreshBudget]
+	}
+
+	refreshed := 0
+	for _, request := range requests {
+		prices, err := fetchPrices(request.Items)
+		if err != nil {
+			log.Error("Failed to refresh prices from ", priceSource.Name(), ": ", err)
+		}
+		// items that got no price wait for the retry delay, instead of coming first again next cycle
+		var missing []Item
+		for _, item := range request.Items {
+			if _, found := prices[item]; !found {
+				missing = append(missing, item)
+			}
+		}
+		if err := recordRefreshAttempts(missing, time.Now()); err != nil {
+			log.Error("Failed to record price refresh attempts: ", err)
+		}
+		if err := updatePrices(prices); err != nil {
+			log.Error("Failed to store refreshed prices: ", err)
+			continue
+		}
+		refreshed += len(prices)
+	}
+	log.Info("Refreshed prices for ", refreshed, " of ", len(items), " items")
+}
+
 func cachePricesFromEvents(events []Event) {
 	itemsSet := make(map[Item]bool)
 	for _, event := range events {
@@ -213,86 +425,13 @@ func cachePricesFromEvents(events []Event) {
 
 	var items []Item
 	for item, included := range itemsSet {
-		if included && !strings.HasSuffix(item.Name, "_NONTRADABLE") {
+		if included && !isNonTradable(item) {
 			items = append(items, item)
 		}
 	}
 
-	_, err := getItemPrices(items)
+	_, err := getItemLocationPrices(items)
 	if err != nil {
 		log.Debug("Failed to get prices for items: ", items)
 	}
 }
-
-func getBuildPrices(builds []Build, itemPrices map[Item]float64, filter BuildFilter) map[Build]float64 {
-	buildPrices := make(map[Build]float64)
-
-	for _, build := range builds {
-		price := 0.0
-		if filter.MainHand && build.MainHand.Name != "" {
-			if itemPrices[build.MainHand] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.MainHand]
-		}
-		if filter.OffHand && build.OffHand.Name != "" {
-			if itemPrices[build.OffHand] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.OffHand]
-		}
-		if filter.Head && build.Head.Name != "" {
-			if itemPrices[build.Head] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Head]
-		}
-		if filter.Chest && build.Chest.Name != "" {
-			if itemPrices[build.Chest] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Chest]
-		}
-		if filter.Foot && build.Foot.Name != "" {
-			if itemPrices[build.Foot] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Foot]
-		}
-		if filter.Cape && build.Cape.Name != "" {
-			if itemPrices[build.Cape] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Cape]
-		}
-		if filter.Potion && build.Potion.Name != "" {
-			if itemPrices[build.Potion] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Potion]
-		}
-		if filter.Food && build.Food.Name != "" {
-			if itemPrices[build.Food] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Food]
-		}
-		if filter.Mount && build.Mount.Name != "" {
-			if itemPrices[build.Mount] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Mount]
-		}
-		if filter.Bag && build.Bag.Name != "" {
-			if itemPrices[build.Bag] == 0.0 {
-				continue
-			}
-			price += itemPrices[build.Bag]
-		}
-		if price != 0.0 {
-			buildPrices[build] = price
-		}
-	}
-
-	return buildPrices
-}
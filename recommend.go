@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// recommendPriorFights is how many fights at the weapon's own win rate every build starts with, so a
+// build that won its only fight doesn't beat one that won most of a hundred
+const recommendPriorFights = 10.0
+
+const defaultRecommendAlternatives = 3
+
+type RecommendedBuild struct {
+	Slots     map[string]string `json:"slots"`
+	Usages    int64             `json:"usages"`
+	WinRate   float64           `json:"win_rate"`
+	Score     float64           `json:"score"`
+	AverageIp float64           `json:"average_ip"`
+	Cost      *float64          `json:"cost"`
+}
+
+type SlotAlternative struct {
+	Item    string  `json:"item"`
+	Usages  int64   `json:"usages"`
+	WinRate float64 `json:"win_rate"`
+	Score   float64 `json:"score"`
+}
+
+type BuildRecommendation struct {
+	Weapon           string                       `json:"weapon"`
+	IpBudget         int                          `json:"ip_budget"`
+	SilverBudget     int                          `json:"silver_budget"`
+	ConsideredBuilds int                          `json:"considered_builds"`
+	WeaponWinRate    float64                      `json:"weapon_win_rate"`
+	Build            RecommendedBuild             `json:"build"`
+	Alternatives     map[string][]SlotAlternative `json:"alternatives"`
+}
+
+func (stats BuildStats) winRate() float64 {
+	return float64(stats.Kills) / math.Max(float64(stats.Kills+stats.Deaths), 1.0)
+}
+
+// score is the win rate pulled towards the base win rate by recommendPriorFights
+func (stats BuildStats) score(baseWinRate float64) float64 {
+	return (float64(stats.Kills) + recommendPriorFights*baseWinRate) / (float64(stats.Kills+stats.Deaths) + recommendPriorFights)
+}
+
+// withinBudget leaves out builds worn at a higher average ip or worth more than the budgets, a zero
+// budget doesn't limit. Builds without any priced gear are left out of a silver budget, their cost is
+// unknown.
+func withinBudget(stats BuildStats, ipBudget int, silverBudget int) bool {
+	usages := math.Max(float64(stats.Kills+stats.Deaths), 1.0)
+	if ipBudget > 0 && stats.SumAverageIp/usages > float64(ipBudget) {
+		return false
+	}
+	if silverBudget <= 0 {
+		return true
+	}
+	cost := stats.averageValue()
+	return cost > 0.0 && cost <= float64(silverBudget)
+}
+
+// recommendBuild picks the best scoring build worn with the weapon within the budgets, rolled up to the
+// spec, and for every slot the best scoring other items worn in it with the weapon
+func recommendBuild(weapon Item, ipBudget int, silverBudget int, valuation Valuation, language string, spec BuildKeySpec, alternatives int) (BuildRecommendation, bool, error) {
+	recommendation := BuildRecommendation{
+		Weapon:       itemToTypeString(weapon),
+		IpBudget:     ipBudget,
+		SilverBudget: silverBudget,
+		Alternatives: make(map[string][]SlotAlternative),
+	}
+
+	buildsToStats, err := getStoredBuildStats(valuation)
+	if err != nil {
+		return recommendation, false, err
+	}
+
+	var weaponStats BuildStats
+	buildKeysToStats := make(map[BuildSlotKeys]BuildStats)
+	slotsToStats := make([]map[SlotKey]BuildStats, len(buildSlotColumns))
+	for slot := range slotsToStats {
+		slotsToStats[slot] = make(map[SlotKey]BuildStats)
+	}
+	for key, stats := range buildsToStats {
+		build, err := parseBuildKey(key)
+		if err != nil {
+			log.Error("Failed to parse build key: ", err)
+			continue
+		}
+		if !itemMatches(weapon, build.MainHand) || !withinBudget(stats, ipBudget, silverBudget) {
+			continue
+		}
+		recommendation.ConsideredBuilds++
+		weaponStats = weaponStats.add(stats)
+		keys := spec.buildKeys(build)
+		buildKeysToStats[keys] = buildKeysToStats[keys].add(stats)
+		for slot, slotKey := range keys {
+			if !slotKey.empty() {
+				slotsToStats[slot][slotKey] = slotsToStats[slot][slotKey].add(stats)
+			}
+		}
+	}
+	if recommendation.ConsideredBuilds == 0 {
+		return recommendation, false, nil
+	}
+	baseWinRate := weaponStats.winRate()
+	recommendation.WeaponWinRate = baseWinRate
+
+	var best BuildSlotKeys
+	var bestStats BuildStats
+	found := false
+	for keys, stats := range buildKeysToStats {
+		if !found || betterScore(stats, keys, bestStats, best, baseWinRate) {
+			best, bestStats, found = keys, stats, true
+		}
+	}
+	recommendation.Build = RecommendedBuild{
+		Slots:     make(map[string]string),
+		Usages:    bestStats.Kills + bestStats.Deaths,
+		WinRate:   bestStats.winRate(),
+		Score:     bestStats.score(baseWinRate),
+		AverageIp: bestStats.SumAverageIp / math.Max(float64(bestStats.Kills+bestStats.Deaths), 1.0),
+	}
+	// null when none of the gear has a price
+	if cost := bestStats.averageValue(); cost > 0.0 {
+		recommendation.Build.Cost = &cost
+	}
+
+	// get human readable
+	keys := append([]SlotKey{}, best[:]...)
+	for _, slotStats := range slotsToStats {
+		for key := range slotStats {
+			keys = append(keys, key)
+		}
+	}
+	names := slotKeyNames(keys, language)
+
+	for slot, key := range best {
+		if key.empty() {
+			continue
+		}
+		recommendation.Build.Slots[buildSlotColumns[slot]] = spec.slotLabel(key, names)
+
+		var candidates []SlotKey
+		for candidate := range slotsToStats[slot] {
+			if candidate != key {
+				candidates = append(candidates, candidate)
+			}
+		}
+		sort.Slice(candidates, func(a, b int) bool {
+			statsA, statsB := slotsToStats[slot][candidates[a]], slotsToStats[slot][candidates[b]]
+			if statsA.score(baseWinRate) != statsB.score(baseWinRate) {
+				return statsA.score(baseWinRate) > statsB.score(baseWinRate)
+			}
+			return candidates[a].String() < candidates[b].String()
+		})
+		slotAlternatives := []SlotAlternative{}
+		for _, candidate := range candidates[:min(alternatives, len(candidates))] {
+			stats := slotsToStats[slot][candidate]
+			slotAlternatives = append(slotAlternatives, SlotAlternative{
+				Item:    spec.slotLabel(candidate, names),
+				Usages:  stats.Kills + stats.Deaths,
+				WinRate: stats.winRate(),
+				Score:   stats.score(baseWinRate),
+			})
+		}
+		recommendation.Alternatives[buildSlotColumns[slot]] = slotAlternatives
+	}
+	return recommendation, true, nil
+}
+
+// betterScore orders builds by score, then by usages, then by their keys so the pick is always the same
+func betterScore(stats BuildStats, keys BuildSlotKeys, otherStats BuildStats, otherKeys BuildSlotKeys, baseWinRate float64) bool {
+	if stats.score(baseWinRate) != otherStats.score(baseWinRate) {
+		return stats.score(baseWinRate) > otherStats.score(baseWinRate)
+	}
+	if stats.Kills+stats.Deaths != otherStats.Kills+otherStats.Deaths {
+		return stats.Kills+stats.Deaths > otherStats.Kills+otherStats.Deaths
+	}
+	return keys.String() < otherKeys.String()
+}
+
+func recommendHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	weapon, err := typeStringToItem(query.Get("weapon"), 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if weapon.Name == "" {
+		http.Error(w, "Missing weapon", http.StatusBadRequest)
+		return
+	}
+	ipBudget, err := intFromQuery(query, "ipBudget", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	silverBudget, err := intFromQuery(query, "silverBudget", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alternatives, err := intFromQuery(query, "alternatives", defaultRecommendAlternatives)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	valuation, err := valuationFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spec, err := buildKeySpecFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recommendation, found, err := recommendBuild(weapon, ipBudget, silverBudget, valuation, language, spec, alternatives)
+	if err != nil {
+		log.Error("Failed to recommend a build: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("No builds with %s within budget", recommendation.Weapon), http.StatusNotFound)
+		return
+	}
+
+	responseJSON, err := json.Marshal(recommendation)
+	if err != nil {
+		http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+}
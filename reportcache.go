@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CachedReport struct {
+	Rows       [][]string
+	ETag       string
+	Generation uint64
+	Created    time.Time
+	Used       time.Time
+}
+
+// reportCache holds generated reports by report name and parsed options, so differently written
+// queries for the same report share an entry. Stale entries are dropped on every access, and past
+// report_cache_size entries the least recently used go first.
+var reportCache = make(map[string]CachedReport)
+var reportCacheMutex sync.Mutex
+
+// reportGeneration is bumped whenever events or prices change, entries from an older generation are stale
+var reportGeneration atomic.Uint64
+
+func invalidateReports() {
+	reportGeneration.Add(1)
+}
+
+func reportCacheKey(name string, options any) string {
+	return fmt.Sprintf("%s %+v", name, options)
+}
+
+func reportETag(rows [][]string) string {
+	hash := sha256.New()
+	for _, row := range rows {
+		for _, column := range row {
+			hash.Write([]byte(column))
+			hash.Write([]byte{0})
+		}
+		hash.Write([]byte{'\n'})
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)[:16])
+}
+
+// representationETag tells the formats and pages of the same report apart
+func representationETag(report CachedReport, format string, page ReportPage) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s %s %+v", report.ETag, format, page)))
+	return fmt.Sprintf("\"%x\"", hash[:16])
+}
+
+func (report CachedReport) fresh(generation uint64) bool {
+	return report.Generation == generation && time.Since(report.Created) < config.ReportCacheTtl
+}
+
+// cachedReport returns the stored report while it is fresh and generates it otherwise. The generation
+// is read before generating, so a report that raced with new events is stored already stale.
+func cachedReport(key string, generate func(RowWriter) error) (CachedReport, error) {
+	generation := reportGeneration.Load()
+
+	reportCacheMutex.Lock()
+	pruneReportCache(generation)
+	report, found := reportCache[key]
+	if found {
+		report.Used = time.Now()
+		reportCache[key] = report
+	}
+	reportCacheMutex.Unlock()
+	if found {
+		log.Debug("Serving cached report: ", key)
+		return report, nil
+	}
+
+	collector := &RowCollector{}
+	if err := generate(collector); err != nil {
+		return CachedReport{Rows: collector.Rows}, err
+	}
+	report = CachedReport{
+		Rows:       collector.Rows,
+		ETag:       reportETag(collector.Rows),
+		Generation: generation,
+		Created:    time.Now(),
+		Used:       time.Now(),
+	}
+	if config.ReportCacheTtl <= 0 {
+		return report, nil
+	}
+
+	reportCacheMutex.Lock()
+	defer reportCacheMutex.Unlock()
+	pruneReportCache(reportGeneration.Load())
+	if config.ReportCacheSize > 0 {
+		for len(reportCache) >= config.ReportCacheSize {
+			evictLeastRecentReport()
+		}
+	}
+	reportCache[key] = report
+	return report, nil
+}
+
+// pruneReportCache drops stale entries, the caller holds reportCacheMutex
+func pruneReportCache(generation uint64) {
+	for key, cached := range reportCache {
+		if !cached.fresh(generation) {
+			delete(reportCache, key)
+		}
+	}
+}
+
+// evictLeastRecentReport drops the entry used longest ago, the caller holds reportCacheMutex
+func evictLeastRecentReport() {
+	var oldestKey string
+	var oldest time.Time
+	for key, cached := range reportCache {
+		if oldestKey == "" || cached.Used.Before(oldest) {
+			oldestKey, oldest = key, cached.Used
+		}
+	}
+	delete(reportCache, oldestKey)
+}
+
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveReport answers from the cache, with 304 Not Modified when the client already has this version
+// of the page. With the cache turned off the report is generated for every request, see serveUncached.
+func serveReport(w http.ResponseWriter, r *http.Request, name string, key string, format string, page ReportPage, generate func(RowWriter) error) {
+	if config.ReportCacheTtl <= 0 {
+		serveUncached(w, name, format, page, generate)
+		return
+	}
+
+	report, err := cachedReport(key, generate)
+	if err != nil {
+		log.Error("Failed to generate report ", name, ": ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := representationETag(report, format, page)
+	rows, err := pageRows(report.Rows, page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxAge := config.ReportCacheTtl - time.Since(report.Created)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeReport(w, name, format, rows)
+}
+
+// serveUncached keeps as few rows in memory as the page allows. With a limit only the rows that can
+// make the page are kept, otherwise the whole report is held to be sorted.
+func serveUncached(w http.ResponseWriter, name string, format string, page ReportPage, generate func(RowWriter) error) {
+	w.Header().Set("Cache-Control", "no-cache")
+
+	var rows [][]string
+	if page.Limit > 0 {
+		collector := &topRowsCollector{page: page}
+		if err := generate(collector); err != nil {
+			if collector.sortError != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Error("Failed to generate report ", name, ": ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rows = collector.Rows()
+	} else {
+		collector := &RowCollector{}
+		if err := generate(collector); err != nil {
+			log.Error("Failed to generate report ", name, ": ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var err error
+		if rows, err = pageRows(collector.Rows, page); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	writeReport(w, name, format, rows)
+}
+
+func writeReport(w http.ResponseWriter, name string, format string, rows [][]string) {
+	writer := newResponseRowWriter(w, name, format)
+	if err := writeRows(writer, rows); err != nil {
+		log.Error("Failed to write report ", name, ": ", err)
+		return
+	}
+	if err := writer.Flush(); err != nil {
+		log.Error("Failed to write report ", name, ": ", err)
+	}
+}
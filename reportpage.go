@@ -0,0 +1,176 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// ReportPage picks the order and the slice of report rows returned, the header is always kept
+type ReportPage struct {
+	Sort   string
+	Order  string
+	Limit  int
+	Offset int
+}
+
+func defaultReportPage() ReportPage {
+	return ReportPage{Sort: "usages", Order: OrderDesc}
+}
+
+func pageFromQuery(query url.Values) (ReportPage, error) {
+	page := defaultReportPage()
+	if query.Has("sort") {
+		page.Sort = query.Get("sort")
+	}
+	if query.Has("order") {
+		page.Order = query.Get("order")
+	}
+	if page.Order != OrderAsc && page.Order != OrderDesc {
+		return page, fmt.Errorf("invalid order: %s", page.Order)
+	}
+
+	var err error
+	if page.Limit, err = intFromQuery(query, "limit", 0); err != nil {
+		return page, err
+	}
+	if page.Offset, err = intFromQuery(query, "offset", 0); err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+// compareColumns compares numerically when both values are numbers, like the ratios and counts in the
+// reports, and as text otherwise
+func compareColumns(a string, b string) int {
+	numberA, errA := strconv.ParseFloat(a, 64)
+	numberB, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil && numberA < numberB:
+		return -1
+	case errA == nil && errB == nil && numberA > numberB:
+		return 1
+	case errA == nil && errB == nil:
+		return 0
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (page ReportPage) sortColumn(header []string) (int, error) {
+	for i, column := range header {
+		if column == page.Sort {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("invalid sort column: %s", page.Sort)
+}
+
+// before orders rows by the column in the page's order, breaking ties on every column from the left so
+// the same report always comes out in the same order
+func (page ReportPage) before(column int, a []string, b []string) bool {
+	if comparison := compareColumns(a[column], b[column]); comparison != 0 {
+		return (comparison < 0) == (page.Order == OrderAsc)
+	}
+	for i := range a {
+		if comparison := compareColumns(a[i], b[i]); comparison != 0 {
+			return comparison < 0
+		}
+	}
+	return false
+}
+
+// pageRows sorts the rows after the header by the page's column and then applies offset and limit
+func pageRows(rows [][]string, page ReportPage) ([][]string, error) {
+	if len(rows) == 0 {
+		return rows, nil
+	}
+	header := rows[0]
+	column, err := page.sortColumn(header)
+	if err != nil {
+		return nil, err
+	}
+
+	body := append([][]string{}, rows[1:]...)
+	sort.SliceStable(body, func(a, b int) bool {
+		return page.before(column, body[a], body[b])
+	})
+	return sliceRows(header, body, page), nil
+}
+
+func sliceRows(header []string, body [][]string, page ReportPage) [][]string {
+	if page.Offset >= len(body) {
+		body = nil
+	} else {
+		body = body[page.Offset:]
+	}
+	if page.Limit > 0 && len(body) > page.Limit {
+		body = body[:page.Limit]
+	}
+	return append([][]string{header}, body...)
+}
+
+// rowHeap keeps the row that comes last in the page's order on top
+type rowHeap struct {
+	rows   [][]string
+	before func(a []string, b []string) bool
+}
+
+func (rows *rowHeap) Len() int           { return len(rows.rows) }
+func (rows *rowHeap) Less(a, b int) bool { return rows.before(rows.rows[b], rows.rows[a]) }
+func (rows *rowHeap) Swap(a, b int)      { rows.rows[a], rows.rows[b] = rows.rows[b], rows.rows[a] }
+func (rows *rowHeap) Push(row any)       { rows.rows = append(rows.rows, row.([]string)) }
+func (rows *rowHeap) Pop() any {
+	row := rows.rows[len(rows.rows)-1]
+	rows.rows = rows.rows[:len(rows.rows)-1]
+	return row
+}
+
+// topRowsCollector keeps only the rows a sorted and limited page can return, offset and limit of them
+type topRowsCollector struct {
+	page      ReportPage
+	header    []string
+	heap      *rowHeap
+	sortError error
+}
+
+func (collector *topRowsCollector) Write(row []string) error {
+	if collector.header == nil {
+		column, err := collector.page.sortColumn(row)
+		if err != nil {
+			collector.sortError = err
+			return err
+		}
+		collector.header = row
+		collector.heap = &rowHeap{before: func(a []string, b []string) bool {
+			return collector.page.before(column, a, b)
+		}}
+		return nil
+	}
+	heap.Push(collector.heap, row)
+	if collector.heap.Len() > collector.page.Offset+collector.page.Limit {
+		heap.Pop(collector.heap)
+	}
+	return nil
+}
+
+func (collector *topRowsCollector) Rows() [][]string {
+	if collector.header == nil {
+		return nil
+	}
+	body := make([][]string, collector.heap.Len())
+	for i := len(body) - 1; i >= 0; i-- {
+		body[i] = heap.Pop(collector.heap).([]string)
+	}
+	return sliceRows(collector.header, body, collector.page)
+}
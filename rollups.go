@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	GroupByItem     = "item"
+	GroupByLine     = "line"
+	GroupByWeight   = "weight"
+	GroupByArtifact = "artifact"
+)
+
+var weaponCategories = map[string]bool{"melee": true, "ranged": true, "magic": true}
+
+var weightClasses = []string{"cloth", "leather", "plate"}
+
+func validateGroupBy(groupBy string) error {
+	switch groupBy {
+	case GroupByItem, GroupByLine, GroupByWeight, GroupByArtifact:
+		return nil
+	}
+	return fmt.Errorf("invalid groupBy: %s", groupBy)
+}
+
+// weaponLine is the shop subcategory of a weapon, like sword or naturestaff
+func weaponLine(item Item) string {
+	meta, found := itemMetaFor(item)
+	if !found || !weaponCategories[meta.Category] {
+		return ""
+	}
+	return meta.Subcategory
+}
+
+// weightClass is cloth, leather or plate for armor pieces. The subcategory carries it, like
+// plate_helmet, but the type string is used when no metadata is stored.
+func weightClass(item Item) string {
+	meta, _ := itemMetaFor(item)
+	if meta.Category != "" && meta.Category != "armor" {
+		return ""
+	}
+	for _, class := range weightClasses {
+		if strings.HasPrefix(meta.Subcategory, class+"_") {
+			return class
+		}
+	}
+	if meta.Category == "" {
+		for _, part := range strings.Split(item.Name, "_") {
+			for _, class := range weightClasses {
+				if strings.EqualFold(part, class) {
+					return class
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func artifactGroup(item Item) string {
+	if meta, found := itemMetaFor(item); found && meta.Artifact {
+		return "artifact"
+	}
+	return "non_artifact"
+}
+
+func itemGroup(item Item, groupBy string) string {
+	switch groupBy {
+	case GroupByLine:
+		return weaponLine(item)
+	case GroupByWeight:
+		return weightClass(item)
+	case GroupByArtifact:
+		return artifactGroup(item)
+	}
+	return ""
+}
+
+// generateRollupReport sums item stats into groups, items without a group are left out
+func generateRollupReport(itemsToStats map[Item]ItemStats, itemsToEstimatedValues map[Item]int64, groupBy string, out RowWriter) error {
+	groupsToStats := make(map[string]ItemStats)
+	groupsToItems := make(map[string]int64)
+	groupsToEstimatedValues := make(map[string]int64)
+	for item, stats := range itemsToStats {
+		group := itemGroup(item, groupBy)
+		if group == "" {
+			continue
+		}
+		groupStats := groupsToStats[group]
+		groupStats.SilverGained += stats.SilverGained
+		groupStats.SilverLost += stats.SilverLost
+		groupStats.Kills += stats.Kills
+		groupStats.Deaths += stats.Deaths
+		groupStats.SumAverageIp += stats.SumAverageIp
+		groupsToStats[group] = groupStats
+		groupsToItems[group] += 1
+		groupsToEstimatedValues[group] += itemsToEstimatedValues[item]
+	}
+
+	var groups []string
+	for group := range groupsToStats {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	err := out.Write([]string{
+		groupBy,
+		"items",
+		"usages",
+		"average_build_ip",
+		"k/d",
+		"silver_ratio",
+		"kills",
+		"deaths",
+		"silver_gained",
+		"silver_lost",
+		"estimated_values",
+	})
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		stats := groupsToStats[group]
+		err := out.Write([]string{
+			group,
+			fmt.Sprintf("%d", groupsToItems[group]),
+			fmt.Sprintf("%d", stats.Kills+stats.Deaths),
+			fmt.Sprintf("%f", stats.SumAverageIp/float64(stats.Kills+stats.Deaths)),
+			fmt.Sprintf("%f", float64(stats.Kills)/math.Max(float64(stats.Deaths), 1.0)),
+			fmt.Sprintf("%f", stats.SilverGained*0.7/math.Max(stats.SilverLost, 1.0)),
+			fmt.Sprintf("%d", stats.Kills),
+			fmt.Sprintf("%d", stats.Deaths),
+			fmt.Sprintf("%f", stats.SilverGained*0.7),
+			fmt.Sprintf("%f", stats.SilverLost),
+			fmt.Sprintf("%d", groupsToEstimatedValues[group]),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type ItemSearchResult struct {
+	Name        string  `json:"name"`
+	DisplayName string  `json:"display_name"`
+	Score       float64 `json:"score"`
+}
+
+type ItemIngredientResponse struct {
+	Item       string `json:"item"`
+	Count      int64  `json:"count"`
+	Returnable bool   `json:"returnable"`
+}
+
+type ItemMetaResponse struct {
+	Category    string                   `json:"category"`
+	Subcategory string                   `json:"subcategory"`
+	SlotType    string                   `json:"slot_type"`
+	ItemPower   float64                  `json:"item_power"`
+	TwoHanded   bool                     `json:"two_handed"`
+	Artifact    bool                     `json:"artifact"`
+	Ingredients []ItemIngredientResponse `json:"ingredients"`
+}
+
+type ItemQualityPrice struct {
+	Quality uint8          `json:"quality"`
+	Value   float64        `json:"value"`
+	Cities  LocationPrices `json:"cities"`
+}
+
+type ItemLookupResponse struct {
+	Item        string             `json:"item"`
+	Name        string             `json:"name"`
+	Tier        uint8              `json:"tier"`
+	Enchantment uint8              `json:"enchantment"`
+	Names       map[string]string  `json:"names"`
+	Meta        *ItemMetaResponse  `json:"meta"`
+	Prices      []ItemQualityPrice `json:"prices"`
+	Report      map[string]string  `json:"report"`
+}
+
+// matchScore rates how well a candidate name matches a search, from 0 for no match to 1 for an exact match
+func matchScore(search string, candidate string) float64 {
+	search = strings.ToLower(strings.TrimSpace(search))
+	candidate = strings.ToLower(candidate)
+	if search == "" || candidate == "" {
+		return 0.0
+	}
+
+	switch {
+	case candidate == search:
+		return 1.0
+	case strings.HasPrefix(candidate, search):
+		return 0.9
+	case strings.Contains(candidate, search):
+		return 0.8
+	}
+
+	// every word somewhere in the name, like "sword broad"
+	words := strings.Fields(search)
+	allWords := len(words) > 1
+	for _, word := range words {
+		allWords = allWords && strings.Contains(candidate, word)
+	}
+	if allWords {
+		return 0.7
+	}
+
+	// the letters in order, like "brdswrd", scored by how much of the name they cover
+	remaining := []rune(candidate)
+	matched := 0
+	for _, letter := range search {
+		if letter == ' ' {
+			continue
+		}
+		found := false
+		for i, candidateLetter := range remaining {
+			if candidateLetter == letter {
+				remaining = remaining[i+1:]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0.0
+		}
+		matched += 1
+	}
+	return 0.6 * float64(matched) / float64(len([]rune(candidate)))
+}
+
+func searchItems(search string, language string, limit int) []ItemSearchResult {
+	names := getItemNames()
+	candidates := make(map[string]bool)
+	for _, languageNames := range []map[string]string{names[LanguageEnglish], names[language]} {
+		for name := range languageNames {
+			candidates[name] = true
+		}
+	}
+
+	var results []ItemSearchResult
+	for name := range candidates {
+		score := matchScore(search, strings.ReplaceAll(name, "_", " "))
+		for _, displayName := range []string{names[LanguageEnglish][name], names[language][name]} {
+			if displayScore := matchScore(search, displayName); displayScore > score {
+				score = displayScore
+			}
+		}
+		if score == 0.0 {
+			continue
+		}
+		displayName := names[language][name]
+		if displayName == "" {
+			displayName = names[LanguageEnglish][name]
+		}
+		results = append(results, ItemSearchResult{Name: name, DisplayName: displayName, Score: score})
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].Name < results[b].Name
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func itemSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("q") == "" {
+		http.Error(w, "Missing q", http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intFromQuery(query, "limit", 20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := searchItems(query.Get("q"), language, limit)
+	if results == nil {
+		results = []ItemSearchResult{}
+	}
+
+	responseJSON, err := json.Marshal(results)
+	if err != nil {
+		http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+}
+
+func itemMetaResponse(item Item) *ItemMetaResponse {
+	meta, found := itemMetaFor(item)
+	if !found {
+		return nil
+	}
+	response := &ItemMetaResponse{
+		Category:    meta.Category,
+		Subcategory: meta.Subcategory,
+		SlotType:    meta.SlotType,
+		ItemPower:   meta.ItemPower,
+		TwoHanded:   meta.TwoHanded,
+		Artifact:    meta.Artifact,
+		Ingredients: []ItemIngredientResponse{},
+	}
+	if meta.Recipe != nil {
+		for _, ingredient := range meta.Recipe.Ingredients {
+			response.Ingredients = append(response.Ingredients, ItemIngredientResponse{
+				Item:       itemToTypeString(ingredient.Item),
+				Count:      ingredient.Count,
+				Returnable: ingredient.Returnable,
+			})
+		}
+	}
+	return response
+}
+
+// itemReportRow finds the item in the item report, which lists items by display name and equivalent tier
+func itemReportRow(item Item, displayName string, valuation Valuation, language string) map[string]string {
+	options := ItemReportOptions{
+		Valuation: valuation,
+		GroupBy:   GroupByItem,
+		Language:  language,
+		IpBasis:   IpBasisReported,
+	}
+	var report [][]string
+	if config.ReportCacheTtl > 0 {
+		cached, err := cachedItemReport(options)
+		if err != nil {
+			return nil
+		}
+		report = cached.Rows
+	} else {
+		// without the cache there is no use in generating the rows of every other item
+		options.Item = item
+		collector := &RowCollector{}
+		if err := generateItemReport(options, collector); err != nil {
+			return nil
+		}
+		report = collector.Rows
+	}
+	if len(report) == 0 {
+		return nil
+	}
+	header := report[0]
+	equivalence := fmt.Sprintf("%d", equivalentItem(item).Tier)
+	for _, row := range report[1:] {
+		if row[0] != displayName || row[2] != equivalence {
+			continue
+		}
+		columns := make(map[string]string)
+		for i, column := range header {
+			columns[column] = row[i]
+		}
+		return columns
+	}
+	return nil
+}
+
+func itemLookupHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	typeString := r.PathValue("type")
+	item, err := typeStringToItem(typeString, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if item.Name == "" {
+		http.Error(w, "Missing item", http.StatusBadRequest)
+		return
+	}
+	valuation, err := valuationFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseData := ItemLookupResponse{
+		Item:        itemToTypeString(item),
+		Name:        item.Name,
+		Tier:        item.Tier,
+		Enchantment: item.Enchantment,
+		Names:       make(map[string]string),
+		Meta:        itemMetaResponse(item),
+	}
+	for nameLanguage, languageNames := range getItemNames() {
+		if displayName := languageNames[item.Name]; displayName != "" {
+			responseData.Names[nameLanguage] = displayName
+		}
+	}
+
+	var qualityItems []Item
+	for quality := uint8(0); quality <= 4; quality++ {
+		qualityItem := item
+		qualityItem.Quality = quality
+		qualityItems = append(qualityItems, qualityItem)
+	}
+	itemLocationPrices, err := getItemLocationPrices(qualityItems)
+	if err != nil {
+		log.Debug("Failed to get some prices for item lookup: ", err)
+	}
+	for _, qualityItem := range qualityItems {
+		cities := itemLocationPrices[qualityItem]
+		if len(cities) == 0 {
+			continue
+		}
+		responseData.Prices = append(responseData.Prices, ItemQualityPrice{
+			Quality: qualityItem.Quality,
+			Value:   valuePrice(cities, valuation),
+			Cities:  cities,
+		})
+	}
+	if responseData.Prices == nil {
+		responseData.Prices = []ItemQualityPrice{}
+	}
+
+	displayName := responseData.Names[language]
+	if displayName == "" {
+		displayName = item.Name
+	}
+	responseData.Report = itemReportRow(item, displayName, valuation, language)
+
+	responseJSON, err := json.Marshal(responseData)
+	if err != nil {
+		http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseJSON)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type PriceSource interface {
+	Name() string
+	FetchPrices(items []Item) (map[Item]LocationPrices, error)
+}
+
+var priceSource PriceSource
+
+func newPriceSource(name string) (PriceSource, error) {
+	switch name {
+	case PriceSourceHistory:
+		return HistoryPriceSource{}, nil
+	case PriceSourceCurrent:
+		return CurrentPriceSource{}, nil
+	case PriceSourceFile:
+		if config.PriceFile == "" {
+			return nil, fmt.Errorf("price source %s requires price_file to be set", name)
+		}
+		return FilePriceSource{Path: config.PriceFile}, nil
+	}
+	return nil, fmt.Errorf("unknown price source: %s", name)
+}
+
+// newConfiguredPriceSource chains the configured sources, an empty list falls back to the default ones
+func newConfiguredPriceSource() (PriceSource, error) {
+	names := config.PriceSources
+	if len(names) == 0 {
+		names = defaultConfig().PriceSources
+	}
+	var chained ChainedPriceSource
+	for _, name := range names {
+		source, err := newPriceSource(name)
+		if err != nil {
+			return nil, err
+		}
+		chained.Sources = append(chained.Sources, source)
+	}
+	if len(chained.Sources) == 0 {
+		return nil, fmt.Errorf("no price sources configured")
+	}
+	if len(chained.Sources) == 1 {
+		return chained.Sources[0], nil
+	}
+	return chained, nil
+}
+
+func mergeMissingPrices(prices map[Item]LocationPrices, fallback map[Item]LocationPrices) {
+	for item, locationPrices := range fallback {
+		if prices[item] == nil {
+			prices[item] = make(LocationPrices)
+		}
+		for location, estimate := range locationPrices {
+			if _, found := prices[item][location]; !found {
+				prices[item][location] = estimate
+			}
+		}
+	}
+}
+
+type HistoryPriceSource struct{}
+
+func (HistoryPriceSource) Name() string {
+	return PriceSourceHistory
+}
+
+func (HistoryPriceSource) FetchPrices(items []Item) (map[Item]LocationPrices, error) {
+	log.Debug("Calling price API for items: ", items)
+	return runPriceRequests(planPriceRequests(config.PriceUrl, historyParams, items), callPriceAPI)
+}
+
+type CurrentPriceSource struct{}
+
+func (CurrentPriceSource) Name() string {
+	return PriceSourceCurrent
+}
+
+func (CurrentPriceSource) FetchPrices(items []Item) (map[Item]LocationPrices, error) {
+	log.Debug("Calling current price API for items: ", items)
+	return runPriceRequests(planPriceRequests(config.CurrentPriceUrl, "", items), callCurrentPriceAPI)
+}
+
+// FilePriceSource reads prices from a local CSV or JSON file with item, quality, location and price
+// for each row. Item is a type string like T4_MAIN_SWORD@1 and quality uses the same numbering as events.
+type FilePriceSource struct {
+	Path string
+}
+
+type FilePriceRecord struct {
+	Item     string  `json:"item"`
+	Quality  uint8   `json:"quality"`
+	Location string  `json:"location"`
+	Price    float64 `json:"price"`
+}
+
+func (source FilePriceSource) Name() string {
+	return PriceSourceFile
+}
+
+func (source FilePriceSource) FetchPrices(items []Item) (map[Item]LocationPrices, error) {
+	prices := make(map[Item]LocationPrices)
+
+	records, err := source.readRecords()
+	if err != nil {
+		log.Error("Failed to read price file: ", source.Path)
+		return prices, err
+	}
+
+	wanted := make(map[Item]bool)
+	for _, item := range items {
+		wanted[item] = true
+	}
+
+	for _, record := range records {
+		item, err := typeStringToItem(record.Item, record.Quality)
+		if err != nil {
+			log.Error("Failed to parse type string in price file: ", record.Item)
+			continue
+		}
+		if !wanted[item] || record.Price <= 0.0 {
+			continue
+		}
+		if prices[item] == nil {
+			prices[item] = make(LocationPrices)
+		}
+		prices[item][normalizeLocation(record.Location)] = PriceEstimate{
+			Price:   record.Price,
+			Method:  EstimatorProvided,
+			Samples: 1,
+			Source:  PriceSourceFile,
+		}
+	}
+
+	return prices, nil
+}
+
+func (source FilePriceSource) readRecords() ([]FilePriceRecord, error) {
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(source.Path), ".json") {
+		var records []FilePriceRecord
+		if err := json.NewDecoder(file).Decode(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+	return readPriceCsv(file)
+}
+
+func readPriceCsv(reader io.Reader) ([]FilePriceRecord, error) {
+	csvReader := csv.NewReader(reader)
+	rows, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, column := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range []string{"item", "quality", "location", "price"} {
+		if _, found := columns[column]; !found {
+			return nil, fmt.Errorf("price file is missing column: %s", column)
+		}
+	}
+
+	var records []FilePriceRecord
+	for line, row := range rows[1:] {
+		quality, err := parseUint8(strings.TrimSpace(row[columns["quality"]]))
+		if err != nil {
+			return records, fmt.Errorf("invalid quality on line %d: %s", line+2, err)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(row[columns["price"]]), 64)
+		if err != nil {
+			return records, fmt.Errorf("invalid price on line %d: %s", line+2, err)
+		}
+		records = append(records, FilePriceRecord{
+			Item:     strings.TrimSpace(row[columns["item"]]),
+			Quality:  quality,
+			Location: strings.TrimSpace(row[columns["location"]]),
+			Price:    price,
+		})
+	}
+	return records, nil
+}
+
+// ChainedPriceSource asks each source in order, only filling in locations the earlier sources missed.
+type ChainedPriceSource struct {
+	Sources []PriceSource
+}
+
+func (chained ChainedPriceSource) Name() string {
+	var names []string
+	for _, source := range chained.Sources {
+		names = append(names, source.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (chained ChainedPriceSource) FetchPrices(items []Item) (map[Item]LocationPrices, error) {
+	prices := make(map[Item]LocationPrices)
+	var errs []error
+
+	remaining := items
+	for _, source := range chained.Sources {
+		if len(remaining) == 0 {
+			break
+		}
+		sourcePrices, err := source.FetchPrices(remaining)
+		if err != nil {
+			log.Error("Price source ", source.Name(), " failed: ", err)
+			errs = append(errs, err)
+		}
+		mergeMissingPrices(prices, sourcePrices)
+
+		var incompleteItems []Item
+		for _, item := range remaining {
+			if len(prices[item]) < len(priceLocations()) {
+				incompleteItems = append(incompleteItems, item)
+			}
+		}
+		remaining = incompleteItems
+	}
+
+	if len(errs) != 0 {
+		return prices, fmt.Errorf("%v", errs)
+	}
+	return prices, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	FormatCsv  = "csv"
+	FormatJson = "json"
+)
+
+// RowWriter takes report rows one at a time, starting with the header
+type RowWriter interface {
+	Write(row []string) error
+}
+
+// ResponseRowWriter writes rows to a response as they come, Flush ends the response body
+type ResponseRowWriter interface {
+	RowWriter
+	Flush() error
+}
+
+// RowCollector keeps every row, for reports that are cached
+type RowCollector struct {
+	Rows [][]string
+}
+
+func (collector *RowCollector) Write(row []string) error {
+	collector.Rows = append(collector.Rows, row)
+	return nil
+}
+
+type csvRowWriter struct {
+	writer *csv.Writer
+}
+
+func (writer csvRowWriter) Write(row []string) error {
+	return writer.writer.Write(row)
+}
+
+func (writer csvRowWriter) Flush() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+// jsonRowWriter writes an array with one object per row, keyed by the header in column order
+type jsonRowWriter struct {
+	writer io.Writer
+	header []string
+	rows   int
+}
+
+func (writer *jsonRowWriter) Write(row []string) error {
+	if writer.header == nil {
+		writer.header = row
+		_, err := io.WriteString(writer.writer, "[")
+		return err
+	}
+
+	separator := ",\n"
+	if writer.rows == 0 {
+		separator = "\n"
+	}
+	writer.rows += 1
+	if _, err := io.WriteString(writer.writer, separator+"{"); err != nil {
+		return err
+	}
+	for i, column := range writer.header {
+		value := ""
+		if i < len(row) {
+			value = row[i]
+		}
+		key, _ := json.Marshal(column)
+		encoded, _ := json.Marshal(value)
+		if i > 0 {
+			if _, err := io.WriteString(writer.writer, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(writer.writer, "%s:%s", key, encoded); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(writer.writer, "}")
+	return err
+}
+
+func (writer *jsonRowWriter) Flush() error {
+	if writer.header == nil {
+		_, err := io.WriteString(writer.writer, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(writer.writer, "\n]\n")
+	return err
+}
+
+func validateFormat(format string) error {
+	if format != FormatCsv && format != FormatJson {
+		return fmt.Errorf("invalid format: %s", format)
+	}
+	return nil
+}
+
+func formatFromQuery(query url.Values) (string, error) {
+	format := FormatCsv
+	if query.Has("format") {
+		format = query.Get("format")
+	}
+	return format, validateFormat(format)
+}
+
+// newResponseRowWriter sets the headers for the format, rows written after this go straight to the client
+func newResponseRowWriter(w http.ResponseWriter, name string, format string) ResponseRowWriter {
+	if format == FormatJson {
+		w.Header().Set("Content-Type", "application/json")
+		return &jsonRowWriter{writer: w}
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s-%d.csv", name, time.Now().Unix()))
+	return csvRowWriter{writer: csv.NewWriter(w)}
+}
+
+func writeRows(writer RowWriter, rows [][]string) error {
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
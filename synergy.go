@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// pairs and partners seen in fewer fights than this are left out, their win rates are mostly noise
+const defaultMinPairUsages = 10
+
+const defaultSynergyPartners = 10
+
+type PairStats struct {
+	Kills  int64
+	Deaths int64
+}
+
+type ItemPair struct {
+	SlotA int
+	KeyA  SlotKey
+	SlotB int
+	KeyB  SlotKey
+}
+
+type SlotItemKey struct {
+	Slot int
+	Key  SlotKey
+}
+
+func (stats PairStats) add(aggregate BuildAggregate) PairStats {
+	stats.Kills += aggregate.Kills
+	stats.Deaths += aggregate.Deaths
+	return stats
+}
+
+func (stats PairStats) usages() int64 {
+	return stats.Kills + stats.Deaths
+}
+
+func (stats PairStats) winRate() float64 {
+	return float64(stats.Kills) / math.Max(float64(stats.usages()), 1.0)
+}
+
+// lift is how a win rate compares to the win rate it is expected to be, above 1 when it does better
+func lift(winRate float64, baseWinRate float64) float64 {
+	if baseWinRate == 0.0 {
+		return 1.0
+	}
+	return winRate / baseWinRate
+}
+
+// forEachKeyedBuild reads the build aggregates with every build keyed by the spec
+func forEachKeyedBuild(spec BuildKeySpec, fn func(build Build, keys BuildSlotKeys, aggregate BuildAggregate)) error {
+	buildAggregates, err := queryBuildAggregates()
+	if err != nil {
+		log.Error("Failed to query build aggregates: ", err)
+		return err
+	}
+
+	for key, aggregate := range buildAggregates {
+		build, err := parseBuildKey(key)
+		if err != nil {
+			log.Error("Failed to parse build key: ", err)
+			continue
+		}
+		fn(build, spec.buildKeys(build), aggregate)
+	}
+	return nil
+}
+
+// buildSlotItemList lists the items of a build in the order of buildSlotColumns
+func buildSlotItemList(build Build) []Item {
+	return []Item{
+		build.MainHand, build.OffHand, build.Head, build.Chest, build.Foot,
+		build.Cape, build.Food, build.Potion, build.Mount, build.Bag,
+	}
+}
+
+// itemMatches compares by name, and by tier and enchantment too when the wanted item has a tier
+func itemMatches(wanted Item, item Item) bool {
+	if wanted.Name != item.Name {
+		return false
+	}
+	return wanted.Tier == 0 || (wanted.Tier == item.Tier && wanted.Enchantment == item.Enchantment)
+}
+
+func generatePairReport(language string, spec BuildKeySpec, minUsages int, out RowWriter) error {
+	itemsToStats := make(map[SlotItemKey]PairStats)
+	pairsToStats := make(map[ItemPair]PairStats)
+	err := forEachKeyedBuild(spec, func(build Build, keys BuildSlotKeys, aggregate BuildAggregate) {
+		for a, keyA := range keys {
+			if keyA.empty() {
+				continue
+			}
+			item := SlotItemKey{Slot: a, Key: keyA}
+			itemsToStats[item] = itemsToStats[item].add(aggregate)
+			for b := a + 1; b < len(keys); b++ {
+				if keys[b].empty() {
+					continue
+				}
+				pair := ItemPair{SlotA: a, KeyA: keyA, SlotB: b, KeyB: keys[b]}
+				pairsToStats[pair] = pairsToStats[pair].add(aggregate)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// get human readable
+	var keys []SlotKey
+	for item := range itemsToStats {
+		keys = append(keys, item.Key)
+	}
+	names := slotKeyNames(keys, language)
+
+	err = out.Write([]string{
+		"slot_a",
+		"item_a",
+		"slot_b",
+		"item_b",
+		"usages",
+		"win_rate",
+		"win_rate_a",
+		"win_rate_b",
+		"lift_a",
+		"lift_b",
+		"kills",
+		"deaths",
+	})
+	if err != nil {
+		return err
+	}
+	for pair, stats := range pairsToStats {
+		if stats.usages() < int64(minUsages) {
+			continue
+		}
+		winRateA := itemsToStats[SlotItemKey{Slot: pair.SlotA, Key: pair.KeyA}].winRate()
+		winRateB := itemsToStats[SlotItemKey{Slot: pair.SlotB, Key: pair.KeyB}].winRate()
+		err := out.Write([]string{
+			buildSlotColumns[pair.SlotA],
+			spec.slotLabel(pair.KeyA, names),
+			buildSlotColumns[pair.SlotB],
+			spec.slotLabel(pair.KeyB, names),
+			fmt.Sprintf("%d", stats.usages()),
+			fmt.Sprintf("%f", stats.winRate()),
+			fmt.Sprintf("%f", winRateA),
+			fmt.Sprintf("%f", winRateB),
+			fmt.Sprintf("%f", lift(stats.winRate(), winRateA)),
+			fmt.Sprintf("%f", lift(stats.winRate(), winRateB)),
+			fmt.Sprintf("%d", stats.Kills),
+			fmt.Sprintf("%d", stats.Deaths),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateSynergyReport lists the partners that lift the item's win rate the most and the least. Lift
+// is the win rate of the two together against the item's own win rate.
+func generateSynergyReport(item Item, language string, spec BuildKeySpec, minUsages int, partners int, out RowWriter) error {
+	var itemStats PairStats
+	partnersToStats := make(map[SlotItemKey]PairStats)
+	pairsToStats := make(map[SlotItemKey]PairStats)
+	err := forEachKeyedBuild(spec, func(build Build, keys BuildSlotKeys, aggregate BuildAggregate) {
+		// the item is looked for in every slot, the spec only decides which slots are partners
+		itemSlot := -1
+		for slot, buildItem := range buildSlotItemList(build) {
+			if buildItem.Name != "" && itemMatches(item, buildItem) {
+				itemSlot = slot
+				break
+			}
+		}
+		for slot, key := range keys {
+			if !key.empty() {
+				partner := SlotItemKey{Slot: slot, Key: key}
+				partnersToStats[partner] = partnersToStats[partner].add(aggregate)
+			}
+		}
+		if itemSlot == -1 {
+			return
+		}
+		itemStats = itemStats.add(aggregate)
+		for slot, key := range keys {
+			if slot != itemSlot && !key.empty() {
+				partner := SlotItemKey{Slot: slot, Key: key}
+				pairsToStats[partner] = pairsToStats[partner].add(aggregate)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var candidates []SlotItemKey
+	for partner, stats := range pairsToStats {
+		if stats.usages() >= int64(minUsages) {
+			candidates = append(candidates, partner)
+		}
+	}
+	partnerLift := func(partner SlotItemKey) float64 {
+		return lift(pairsToStats[partner].winRate(), itemStats.winRate())
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		liftA, liftB := partnerLift(candidates[a]), partnerLift(candidates[b])
+		if liftA != liftB {
+			return liftA > liftB
+		}
+		if pairsToStats[candidates[a]].usages() != pairsToStats[candidates[b]].usages() {
+			return pairsToStats[candidates[a]].usages() > pairsToStats[candidates[b]].usages()
+		}
+		if candidates[a].Slot != candidates[b].Slot {
+			return candidates[a].Slot < candidates[b].Slot
+		}
+		return candidates[a].Key.String() < candidates[b].Key.String()
+	})
+
+	// the best from the top and the worst from the bottom, without listing a partner twice
+	best := min(partners, (len(candidates)+1)/2)
+	worst := min(partners, len(candidates)-best)
+
+	// get human readable
+	var keys []SlotKey
+	for _, partner := range candidates {
+		keys = append(keys, partner.Key)
+	}
+	names := slotKeyNames(keys, language)
+
+	err = out.Write([]string{
+		"side",
+		"partner_slot",
+		"partner",
+		"usages",
+		"win_rate",
+		"item_win_rate",
+		"partner_win_rate",
+		"lift",
+		"partner_lift",
+		"kills",
+		"deaths",
+	})
+	if err != nil {
+		return err
+	}
+	write := func(side string, partner SlotItemKey) error {
+		stats := pairsToStats[partner]
+		return out.Write([]string{
+			side,
+			buildSlotColumns[partner.Slot],
+			spec.slotLabel(partner.Key, names),
+			fmt.Sprintf("%d", stats.usages()),
+			fmt.Sprintf("%f", stats.winRate()),
+			fmt.Sprintf("%f", itemStats.winRate()),
+			fmt.Sprintf("%f", partnersToStats[partner].winRate()),
+			fmt.Sprintf("%f", partnerLift(partner)),
+			fmt.Sprintf("%f", lift(stats.winRate(), partnersToStats[partner].winRate())),
+			fmt.Sprintf("%d", stats.Kills),
+			fmt.Sprintf("%d", stats.Deaths),
+		})
+	}
+	for _, partner := range candidates[:best] {
+		if err := write("best", partner); err != nil {
+			return err
+		}
+	}
+	for _, partner := range candidates[len(candidates)-worst:] {
+		if err := write("worst", partner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pairReportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := formatFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := pageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spec, err := buildKeySpecFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minUsages, err := intFromQuery(query, "minUsages", defaultMinPairUsages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := struct {
+		Language  string
+		Spec      BuildKeySpec
+		MinUsages int
+	}{language, spec, minUsages}
+	serveReport(w, r, "pairReport", reportCacheKey("pairReport", options), format, page, func(out RowWriter) error {
+		return generatePairReport(language, spec, minUsages, out)
+	})
+}
+
+func synergyHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	item, err := typeStringToItem(query.Get("item"), 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if item.Name == "" {
+		http.Error(w, "Missing item", http.StatusBadRequest)
+		return
+	}
+	language, err := languageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := formatFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// best partners first unless asked otherwise
+	if !query.Has("sort") {
+		query.Set("sort", "lift")
+	}
+	page, err := pageFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spec, err := buildKeySpecFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minUsages, err := intFromQuery(query, "minUsages", defaultMinPairUsages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	partners, err := intFromQuery(query, "partners", defaultSynergyPartners)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	options := struct {
+		Item      Item
+		Language  string
+		Spec      BuildKeySpec
+		MinUsages int
+		Partners  int
+	}{item, language, spec, minUsages, partners}
+	serveReport(w, r, "synergy", reportCacheKey("synergy", options), format, page, func(out RowWriter) error {
+		return generateSynergyReport(item, language, spec, minUsages, partners, out)
+	})
+}
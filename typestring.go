@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxTier = 8
+const maxEnchantment = 4
+
+const levelSuffix = "_LEVEL"
+
+var (
+	ErrInvalidTier        = errors.New("invalid tier")
+	ErrInvalidName        = errors.New("invalid item name")
+	ErrInvalidEnchantment = errors.New("invalid enchantment")
+	ErrLevelMismatch      = errors.New("enchantment does not match level suffix")
+)
+
+// TypeStringError is returned for type strings that don't follow the grammar, Err is one of the
+// ErrInvalid errors above so callers can tell what was wrong with errors.Is
+type TypeStringError struct {
+	TypeString string
+	Position   int
+	Err        error
+}
+
+func (err *TypeStringError) Error() string {
+	return fmt.Sprintf("type string %q at position %d: %s", err.TypeString, err.Position, err.Err)
+}
+
+func (err *TypeStringError) Unwrap() error {
+	return err.Err
+}
+
+// typeStringParser reads type strings of the form
+//
+//	typeString  = [ "T" number "_" ] name [ "@" number ]
+//	name        = nameChar { nameChar }
+//	nameChar    = letter | digit | "_"
+//
+// Items without a tier prefix, like UNIQUE_ and skin items, get tier 0. Names ending in _LEVEL and a
+// number are enchanted resources, the level is their enchantment when there is no @ suffix.
+type typeStringParser struct {
+	input    string
+	position int
+}
+
+func (parser *typeStringParser) fail(err error) error {
+	return &TypeStringError{TypeString: parser.input, Position: parser.position, Err: err}
+}
+
+func (parser *typeStringParser) peek() byte {
+	if parser.position >= len(parser.input) {
+		return 0
+	}
+	return parser.input[parser.position]
+}
+
+func (parser *typeStringParser) number() (string, bool) {
+	start := parser.position
+	for parser.peek() >= '0' && parser.peek() <= '9' {
+		parser.position++
+	}
+	return parser.input[start:parser.position], parser.position > start
+}
+
+func isNameChar(char byte) bool {
+	return (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '_'
+}
+
+// tierPrefix only consumes input when it is a complete T<number>_ prefix, anything else is part of the name
+func (parser *typeStringParser) tierPrefix() (uint8, error) {
+	if parser.peek() != 'T' {
+		return 0, nil
+	}
+	start := parser.position
+	parser.position++
+	digits, found := parser.number()
+	if !found || parser.peek() != '_' {
+		parser.position = start
+		return 0, nil
+	}
+	tier, err := strconv.ParseUint(digits, 10, 8)
+	if err != nil || tier < 1 || tier > maxTier {
+		parser.position = start + 1
+		return 0, parser.fail(ErrInvalidTier)
+	}
+	parser.position++ // the underscore
+	return uint8(tier), nil
+}
+
+func (parser *typeStringParser) name() (string, error) {
+	start := parser.position
+	for isNameChar(parser.peek()) {
+		parser.position++
+	}
+	if parser.position == start {
+		return "", parser.fail(ErrInvalidName)
+	}
+	return parser.input[start:parser.position], nil
+}
+
+func (parser *typeStringParser) enchantment() (uint8, bool, error) {
+	if parser.peek() != '@' {
+		return 0, false, nil
+	}
+	parser.position++
+	digits, found := parser.number()
+	if !found {
+		return 0, false, parser.fail(ErrInvalidEnchantment)
+	}
+	enchantment, err := strconv.ParseUint(digits, 10, 8)
+	if err != nil || enchantment > maxEnchantment {
+		parser.position -= len(digits)
+		return 0, false, parser.fail(ErrInvalidEnchantment)
+	}
+	return uint8(enchantment), true, nil
+}
+
+func nameLevel(name string) (uint8, bool) {
+	index := strings.LastIndex(name, levelSuffix)
+	if index <= 0 {
+		return 0, false
+	}
+	level, err := strconv.ParseUint(name[index+len(levelSuffix):], 10, 8)
+	if err != nil || level > maxEnchantment {
+		return 0, false
+	}
+	return uint8(level), true
+}
+
+func parseTypeString(typeString string) (Item, error) {
+	var item Item
+	var err error
+	parser := typeStringParser{input: typeString}
+
+	if item.Tier, err = parser.tierPrefix(); err != nil {
+		return Item{}, err
+	}
+	nameStart := parser.position
+	if item.Name, err = parser.name(); err != nil {
+		return Item{}, err
+	}
+	enchantment, enchanted, err := parser.enchantment()
+	if err != nil {
+		return Item{}, err
+	}
+	if parser.position != len(typeString) {
+		return Item{}, parser.fail(ErrInvalidName)
+	}
+
+	item.Enchantment = enchantment
+	if level, found := nameLevel(item.Name); found {
+		if enchanted && enchantment != level {
+			parser.position = nameStart
+			return Item{}, parser.fail(ErrLevelMismatch)
+		}
+		item.Enchantment = level
+	}
+	return item, nil
+}
+
+func typeStringToItem(typeString string, quality uint8) (Item, error) {
+	if typeString == "" {
+		return Item{}, nil
+	}
+	item, err := parseTypeString(typeString)
+	if err != nil {
+		log.Debug("Failed to parse type string: ", err)
+		return item, err
+	}
+	item.Quality = quality
+	return item, nil
+}
+
+func itemToTypeString(item Item) string {
+	typeString := item.Name
+	if item.Tier != 0 {
+		typeString = fmt.Sprintf("T%d_%s", item.Tier, item.Name)
+	}
+	if item.Enchantment == 0 {
+		return typeString
+	}
+	return fmt.Sprintf("%s@%d", typeString, item.Enchantment)
+}
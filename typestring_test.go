@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTypeString(t *testing.T) {
+	tests := []struct {
+		typeString string
+		item       Item
+		err        error
+	}{
+		{"T4_MAIN_SWORD", Item{Name: "MAIN_SWORD", Tier: 4}, nil},
+		{"T8_2H_CLAYMORE@3", Item{Name: "2H_CLAYMORE", Tier: 8, Enchantment: 3}, nil},
+		{"UNIQUE_HIDEOUT", Item{Name: "UNIQUE_HIDEOUT"}, nil},
+		{"UNIQUE_GVGTOKEN_GENERIC@2", Item{Name: "UNIQUE_GVGTOKEN_GENERIC", Enchantment: 2}, nil},
+		{"T5_PLANKS_LEVEL2", Item{Name: "PLANKS_LEVEL2", Tier: 5, Enchantment: 2}, nil},
+		{"T5_PLANKS_LEVEL2@2", Item{Name: "PLANKS_LEVEL2", Tier: 5, Enchantment: 2}, nil},
+		{"T5_PLANKS_LEVEL2@3", Item{}, ErrLevelMismatch},
+		{"T5_PLANKS_LEVEL9", Item{Name: "PLANKS_LEVEL9", Tier: 5}, nil},
+		{"TOOL_SICKLE", Item{Name: "TOOL_SICKLE"}, nil},
+		{"T_SWORD", Item{Name: "T_SWORD"}, nil},
+		{"T0_MAIN_SWORD", Item{}, ErrInvalidTier},
+		{"T9_MAIN_SWORD", Item{}, ErrInvalidTier},
+		{"T999_MAIN_SWORD", Item{}, ErrInvalidTier},
+		{"T4_", Item{}, ErrInvalidName},
+		{"T4_MAIN_SWORD@", Item{}, ErrInvalidEnchantment},
+		{"T4_MAIN_SWORD@5", Item{}, ErrInvalidEnchantment},
+		{"T4_MAIN_SWORD@1@2", Item{}, ErrInvalidName},
+		{"T4_MAIN_SWORD@x", Item{}, ErrInvalidEnchantment},
+		{"@1", Item{}, ErrInvalidName},
+		{"T4_MAIN SWORD", Item{}, ErrInvalidName},
+	}
+	for _, test := range tests {
+		item, err := parseTypeString(test.typeString)
+		if test.err != nil {
+			var typeStringErr *TypeStringError
+			if !errors.Is(err, test.err) || !errors.As(err, &typeStringErr) {
+				t.Errorf("parseTypeString(%q) error = %v, want %v", test.typeString, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTypeString(%q) error = %v", test.typeString, err)
+			continue
+		}
+		if item != test.item {
+			t.Errorf("parseTypeString(%q) = %+v, want %+v", test.typeString, item, test.item)
+		}
+	}
+}
+
+func FuzzParseTypeString(f *testing.F) {
+	for _, seed := range []string{
+		"T4_MAIN_SWORD",
+		"T8_2H_CLAYMORE@3",
+		"UNIQUE_HIDEOUT",
+		"T5_PLANKS_LEVEL2@2",
+		"T9_MAIN_SWORD",
+		"T4_MAIN_SWORD@",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, typeString string) {
+		item, err := typeStringToItem(typeString, 0)
+		if err != nil {
+			return
+		}
+		typeString = itemToTypeString(item)
+		roundTrip, err := typeStringToItem(typeString, 0)
+		if err != nil {
+			t.Fatalf("typeStringToItem(%q) of a formatted item failed: %v", typeString, err)
+		}
+		if roundTrip != item {
+			t.Fatalf("typeStringToItem(%q) = %+v, want %+v", typeString, roundTrip, item)
+		}
+	})
+}